@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"testing"
 
 	"github.com/iter8-tools/handler/tasks"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func init() {
@@ -38,3 +44,64 @@ func TestEnv(t *testing.T) {
 	_, err = getExperimentNN()
 	assert.Error(t, err)
 }
+
+func TestValidate(t *testing.T) {
+	defer func() { filePath, action = "", "" }()
+	filePath = "../testdata/experiment6.yaml"
+	action = ""
+	out := &bytes.Buffer{}
+	assert.NoError(t, validate(out))
+	assert.Equal(t, `action finish, task 0 (common/exec)
+action start, task 0 (common/exec)
+  with.args[1]: .revision
+  with.args[2]: .omg
+    missing: .omg
+action start, task 1 (common/exec)
+`, out.String())
+
+	filePath = "../testdata/experiment2.yaml"
+	action = "start"
+	out.Reset()
+	assert.NoError(t, validate(out))
+	assert.Contains(t, out.String(), "  with.args[1]: .revision\n    missing: .revision\n")
+
+	action = "unknown"
+	assert.Error(t, validate(out))
+}
+
+func TestValidateRefs(t *testing.T) {
+	defer func() { filePath, action = "", "" }()
+	filePath = "../testdata/experiment11.yaml"
+	action = "start"
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+
+	// keys of secrets and config maps that cannot be loaded are unverified rather than missing
+	tasks.GetClient = func() (client.Client, error) {
+		return nil, errors.New("no cluster")
+	}
+	out := &bytes.Buffer{}
+	assert.NoError(t, validate(out))
+	assert.Contains(t, out.String(), "  secrets and config maps not loaded: ")
+	assert.Contains(t, out.String(), "  with.args[0]: .configMaps.settings.endpoint .secrets.creds.token\n"+
+		"    unverified: .configMaps.settings.endpoint .secrets.creds.token\n")
+	assert.Contains(t, out.String(), "  with.args[1]: .secrets.other.token\n    missing: .secrets.other.token\n")
+
+	// and are resolved as when the task runs otherwise
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"},
+			Data:       map[string][]byte{"token": []byte("t0ken")},
+		}, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+			Data:       map[string]string{"endpoint": "http://example.com"},
+		}).Build(), nil
+	}
+	out.Reset()
+	assert.NoError(t, validate(out))
+	assert.Equal(t, `action start, task 0 (common/exec)
+  with.args[0]: .configMaps.settings.endpoint .secrets.creds.token
+  with.args[1]: .secrets.other.token
+    missing: .secrets.other.token
+`, out.String())
+}
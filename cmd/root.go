@@ -45,6 +45,18 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", ".handler.yaml", "config file (default is .handler.yaml)")
+	rootCmd.PersistentFlags().String("log-format", string(tasks.TextLogFormat), "format of log output: text or json")
+	viper.BindPFlag("log_format", rootCmd.PersistentFlags().Lookup("log-format"))
+	rootCmd.PersistentFlags().String("kube-context", "", "kubeconfig context used to connect to the cluster (default is the current context)")
+	viper.BindPFlag("kube_context", rootCmd.PersistentFlags().Lookup("kube-context"))
+	rootCmd.PersistentFlags().Float32("kube-qps", 0, "maximum rate of requests to the Kubernetes API server (default is the client-go default)")
+	viper.BindPFlag("kube_qps", rootCmd.PersistentFlags().Lookup("kube-qps"))
+	rootCmd.PersistentFlags().Int("kube-burst", 0, "maximum burst of requests to the Kubernetes API server (default is the client-go default)")
+	viper.BindPFlag("kube_burst", rootCmd.PersistentFlags().Lookup("kube-burst"))
+	rootCmd.PersistentFlags().String("as", "", "user to impersonate in requests to the Kubernetes API server")
+	viper.BindPFlag("impersonate_user", rootCmd.PersistentFlags().Lookup("as"))
+	rootCmd.PersistentFlags().StringSlice("as-group", nil, "group to impersonate in requests to the Kubernetes API server; may be repeated")
+	viper.BindPFlag("impersonate_groups", rootCmd.PersistentFlags().Lookup("as-group"))
 	log = tasks.GetLogger()
 }
 
@@ -77,4 +89,27 @@ func initConfig() {
 	if err == nil {
 		tasks.SetLogLevel(ll)
 	}
+
+	if err := tasks.SetLogFormat(tasks.LogFormat(viper.GetString("log_format"))); err != nil {
+		log.Warn(err)
+	}
+
+	// templates are interpolated using text/template unless template_mode is html
+	if mode := viper.GetString("template_mode"); mode != "" {
+		if err := tasks.SetTemplateMode(tasks.TemplateMode(mode)); err != nil {
+			log.Warn(err)
+		}
+	}
+
+	// templates that reference missing keys fail to interpolate if strict_templates is true
+	tasks.SetStrictTemplates(viper.GetBool("strict_templates"))
+
+	// the Kubernetes client used by tasks
+	tasks.SetClientOptions(tasks.ClientOptions{
+		Context:           viper.GetString("kube_context"),
+		QPS:               float32(viper.GetFloat64("kube_qps")),
+		Burst:             viper.GetInt("kube_burst"),
+		Impersonate:       viper.GetString("impersonate_user"),
+		ImpersonateGroups: viper.GetStringSlice("impersonate_groups"),
+	})
 }
@@ -57,6 +57,12 @@ Loop:
 		} else {
 			err = errors.New("no library specified")
 		}
+		// inputs common to all tasks
+		if err == nil {
+			if err = tasks.Configure(action[i], &actionSpec[i]); err != nil {
+				break
+			}
+		}
 	}
 	return action, err
 }
@@ -69,11 +75,20 @@ func run(cmd *cobra.Command, args []string) error {
 		if exp, err = (&tasks.Builder{}).FromCluster(nn).Build(); err == nil {
 			var actionSpec v2alpha2.Action
 			if actionSpec, err = exp.GetActionSpec(action); err == nil {
+				actionName := action
 				var action tasks.Action
 				if action, err = GetAction(exp, actionSpec); err == nil {
 					ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+					ctx = context.WithValue(ctx, tasks.ContextKey("action"), actionName)
 					log.Trace("created context for experiment")
+					shutdown, e := tasks.SetupTracing(ctx)
+					if e != nil {
+						log.Warn("cannot set up tracing: ", e)
+					}
 					err = action.Run(ctx)
+					if e = shutdown(context.Background()); e != nil {
+						log.Warn("cannot export traces: ", e)
+					}
 					if err == nil {
 						return nil
 					}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/spf13/cobra"
+)
+
+// taskTemplate is a template in the inputs of a task
+type taskTemplate struct {
+	// path of the template in the task spec, such as with.script
+	path string
+	// template string
+	value string
+}
+
+// taskTemplates returns the templates in the inputs of a task, sorted by path
+func taskTemplates(spec *v2alpha2.TaskSpec) ([]taskTemplate, error) {
+	templates := []taskTemplate{}
+	for name, raw := range spec.With {
+		var v interface{}
+		if err := json.Unmarshal(raw.Raw, &v); err != nil {
+			return nil, err
+		}
+		templates = appendTemplates(templates, "with."+name, v)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].path < templates[j].path })
+	return templates, nil
+}
+
+// appendTemplates appends the strings in v which contain template actions
+func appendTemplates(templates []taskTemplate, path string, v interface{}) []taskTemplate {
+	switch value := v.(type) {
+	case string:
+		if strings.Contains(value, "{{") {
+			templates = append(templates, taskTemplate{path: path, value: value})
+		}
+	case []interface{}:
+		for i := range value {
+			templates = appendTemplates(templates, fmt.Sprintf("%s[%d]", path, i), value[i])
+		}
+	case map[string]interface{}:
+		for k := range value {
+			templates = appendTemplates(templates, path+"."+k, value[k])
+		}
+	}
+	return templates
+}
+
+// unverified returns true if a key is under one of the keys of referenced secrets and config maps, as returned by RefKeys
+func unverified(key string, refKeys []string) bool {
+	for _, rk := range refKeys {
+		if key == rk || strings.HasPrefix(key, rk+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// validate is a helper function used in the definition of validateCmd cobra command.
+// It reports the keys referenced by the templates of each task, and the keys that are missing from the data model of the experiment.
+// Tasks may add keys specific to them, such as .summary, so missing keys are not errors.
+// The secrets and config maps referenced by a task are loaded as when the task runs; if they cannot be loaded,
+// such as when validating a file without access to the cluster, the keys under them are reported as unverified rather than missing.
+func validate(out io.Writer) error {
+	var exp *tasks.Experiment
+	var err error
+	if filePath != "" {
+		exp, err = (&tasks.Builder{}).FromFile(filePath).Build()
+	} else {
+		nn, e := getExperimentNN()
+		if e != nil {
+			return e
+		}
+		exp, err = (&tasks.Builder{}).FromCluster(nn).Build()
+	}
+	if err != nil {
+		return err
+	}
+
+	names := []string{action}
+	if action == "" {
+		names = []string{}
+		for name := range exp.Spec.Strategy.Actions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	for _, name := range names {
+		actionSpec, err := exp.GetActionSpec(name)
+		if err != nil {
+			return err
+		}
+		a, err := GetAction(exp, actionSpec)
+		if err != nil {
+			return fmt.Errorf("invalid action %s: %v", name, err)
+		}
+		for i := range actionSpec {
+			templates, err := taskTemplates(&actionSpec[i])
+			if err != nil {
+				return err
+			}
+			info := &tasks.TaskInfo{Action: name, Index: i, Name: actionSpec[i].Task}
+			refKeys := []string{}
+			var refsErr error
+			if c, ok := a[i].(interface{ GetCommonInputs() *tasks.CommonInputs }); ok {
+				ci := c.GetCommonInputs()
+				info.StrictTemplates = ci.StrictTemplates
+				if refsErr = info.LoadRefs(ci); refsErr != nil {
+					refKeys = ci.RefKeys()
+				}
+			}
+			ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+			ctx = tasks.WithTaskInfo(ctx, info)
+			tags := tasks.ExperimentTags(ctx, exp)
+			mode := ""
+			if tags.IsStrict() {
+				mode = " (strict)"
+			}
+
+			fmt.Fprintf(out, "action %s, task %d (%s)%s\n", name, i, actionSpec[i].Task, mode)
+			if refsErr != nil {
+				fmt.Fprintf(out, "  secrets and config maps not loaded: %v\n", refsErr)
+			}
+			for _, t := range templates {
+				keys, err := tasks.TemplateKeys(t.value)
+				if err != nil {
+					return fmt.Errorf("invalid template %s of task %d of action %s: %v", t.path, i, name, err)
+				}
+				missing, unloaded := []string{}, []string{}
+				for _, k := range keys {
+					if tags.Has(k) {
+						continue
+					}
+					if unverified(k, refKeys) {
+						unloaded = append(unloaded, k)
+					} else {
+						missing = append(missing, k)
+					}
+				}
+				fmt.Fprintf(out, "  %s: %s\n", t.path, strings.Join(keys, " "))
+				if len(missing) > 0 {
+					fmt.Fprintf(out, "    missing: %s\n", strings.Join(missing, " "))
+				}
+				if len(unloaded) > 0 {
+					fmt.Fprintf(out, "    unverified: %s\n", strings.Join(unloaded, " "))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "report the keys referenced by templates",
+	Long:  `Report the keys referenced by the templates of each task in the specified action, or in all actions, and the keys that are missing from the data model of the experiment. Keys specific to a task, such as summary, are reported as missing. Keys of secrets and config maps referenced by a task are reported as unverified if they cannot be loaded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validate(cmd.OutOrStdout()); err != nil {
+			log.Error("Exiting with error: ", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().StringVarP(&action, "action", "a", "", "name of the action; all actions if not specified")
+	validateCmd.Flags().StringVarP(&filePath, "file", "f", "", "experiment file; the experiment in the cluster if not specified")
+}
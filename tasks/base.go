@@ -2,6 +2,12 @@ package tasks
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 )
 
 func init() {
@@ -16,38 +22,136 @@ type Task interface {
 // Action is a slice of Tasks.
 type Action []Task
 
+// CommonInputs are inputs common to all tasks; they may be specified together with the inputs of any task.
+type CommonInputs struct {
+	// interpolate the templates of the task in strict mode, in which missing keys are errors; optional; default is the global setting
+	StrictTemplates *bool `json:"strictTemplates,omitempty" yaml:"strictTemplates,omitempty"`
+	// secrets whose data is available to templates as .secrets.<name>; names must be unique, even across namespaces; optional
+	Secrets []ObjectRef `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+	// config maps whose data is available to templates as .configMaps.<name>; names must be unique, even across namespaces; optional
+	ConfigMaps []ObjectRef `json:"configMaps,omitempty" yaml:"configMaps,omitempty"`
+}
+
 // TaskMeta is common to all Tasks
 type TaskMeta struct {
 	Library string `json:"library" yaml:"library"`
 	Task    string `json:"task" yaml:"task"`
+	// Common are the inputs common to all tasks; they are set by Configure
+	Common CommonInputs `json:"-" yaml:"-"`
+}
+
+// GetCommonInputs returns the inputs common to all tasks.
+func (tm *TaskMeta) GetCommonInputs() *CommonInputs {
+	return &tm.Common
+}
+
+// configurable is implemented by tasks that accept the inputs common to all tasks
+type configurable interface {
+	GetCommonInputs() *CommonInputs
+}
+
+// Configure sets the inputs common to all tasks from the inputs of the task spec.
+// Tasks that do not accept common inputs are left unchanged.
+func Configure(t Task, spec *v2alpha2.TaskSpec) error {
+	c, ok := t.(configurable)
+	if !ok || len(spec.With) == 0 {
+		return nil
+	}
+	jsonBytes, err := json.Marshal(spec.With)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(jsonBytes, c.GetCommonInputs()); err != nil {
+		return err
+	}
+	return c.GetCommonInputs().validateRefs()
+}
+
+// TaskName returns the name of the task, including its library.
+func (tm TaskMeta) TaskName() string {
+	if tm.Library == "" {
+		return tm.Task
+	}
+	return tm.Library + "/" + tm.Task
+}
+
+// taskName returns the name of a task for use in events and logs
+func taskName(t Task) string {
+	if nt, ok := t.(interface{ TaskName() string }); ok && nt.TaskName() != "" {
+		return nt.TaskName()
+	}
+	return fmt.Sprintf("%T", t)
 }
 
 // Run the given action.
+// Kubernetes events are recorded on the experiment when the action starts and finishes,
+// and when each task succeeds, fails, is skipped, or fails with its failure ignored.
+// While the action runs, log entries have fields identifying the experiment, action and task.
 func (a *Action) Run(ctx context.Context) error {
+	name := GetActionNameFromContext(ctx)
+	fields := logrus.Fields{ActionLogField: name}
+	if exp, err := GetExperimentFromContext(ctx); err == nil {
+		fields[ExperimentLogField] = exp.Name
+		fields[NamespaceLogField] = exp.Namespace
+	}
+	AddLogFields(fields)
+	defer RemoveLogFields(ExperimentLogField, NamespaceLogField, ActionLogField, TaskIndexLogField, TaskLogField)
+
+	ctx, actionSpan := StartSpan(ctx, "action "+name, ActionAttribute.String(name))
+	defer setTraceParent(nil)
+
+	RecordEvent(ctx, corev1.EventTypeNormal, ActionStartedReason, fmt.Sprintf("action %s started with %d tasks", name, len(*a)))
 	for i := 0; i < len(*a); i++ {
-		log.Info("------ task starting")
-		err := (*a)[i].Run(ctx)
+		tn := taskName((*a)[i])
+		AddLogFields(logrus.Fields{TaskIndexLogField: i, TaskLogField: tn})
+		log.Info("task starting")
+		outcome := &taskOutcome{}
+		taskCtx, taskSpan := StartSpan(ctx, "task "+tn, ActionAttribute.String(name), TaskIndexAttribute.Int(i), TaskAttribute.String(tn))
+		setTraceParent(taskCtx)
+		taskCtx = context.WithValue(taskCtx, outcomeKey, outcome)
+		info := &TaskInfo{Action: name, Index: i, Name: tn}
+		var err error
+		if c, ok := (*a)[i].(configurable); ok {
+			ci := c.GetCommonInputs()
+			info.StrictTemplates = ci.StrictTemplates
+			err = info.LoadRefs(ci)
+		}
+		if err == nil {
+			taskCtx = WithTaskInfo(taskCtx, info)
+			err = (*a)[i].Run(taskCtx)
+		} else {
+			log.Error(err)
+		}
+		EndSpan(taskSpan, err)
 		if err != nil {
+			EndSpan(actionSpan, err)
+			RecordEvent(ctx, corev1.EventTypeWarning, TaskFailedReason, fmt.Sprintf("task %d (%s) of action %s failed: %v", i, tn, name, err))
+			RecordEvent(ctx, corev1.EventTypeWarning, ActionFailedReason, fmt.Sprintf("action %s failed at task %d (%s)", name, i, tn))
 			return err
 		}
+		switch {
+		case outcome.skipped != nil:
+			RecordEvent(ctx, corev1.EventTypeNormal, TaskSkippedReason, fmt.Sprintf("task %d (%s) of action %s skipped: %s", i, tn, name, *outcome.skipped))
+		case outcome.ignored != nil:
+			RecordEvent(ctx, corev1.EventTypeWarning, TaskFailureIgnoredReason, fmt.Sprintf("task %d (%s) of action %s failed; failure ignored: %v", i, tn, name, outcome.ignored))
+		default:
+			RecordEvent(ctx, corev1.EventTypeNormal, TaskSucceededReason, fmt.Sprintf("task %d (%s) of action %s succeeded", i, tn, name))
+		}
 	}
+	EndSpan(actionSpan, nil)
+	RecordEvent(ctx, corev1.EventTypeNormal, ActionCompletedReason, fmt.Sprintf("action %s completed", name))
 	return nil
 }
 
-// GetDefaultTags creates interpolation.Tags from experiment referenced by context
+// GetDefaultTags creates interpolation.Tags of the data model available to templates (see ExperimentTags)
+// from experiment referenced by context
 func GetDefaultTags(ctx context.Context) *Tags {
-	tags := NewTags()
 	exp, err := GetExperimentFromContext(ctx)
-	if err == nil {
-		obj, err := exp.ToMap()
-		if err == nil {
-			tags = tags.
-				With("this", obj).
-				WithRecommendedVersionForPromotion(&exp.Experiment)
-		}
-	} else {
+	if err != nil {
 		log.Warn("No experiment found in context")
+		tags := NewTags()
+		return &tags
 	}
-
+	tags := ExperimentTags(ctx, exp)
 	return &tags
 }
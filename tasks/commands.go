@@ -6,6 +6,7 @@ import (
 	"github.com/iter8-tools/etc3/api/v2alpha2"
 	iter8 "github.com/iter8-tools/etc3/api/v2alpha2"
 	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -96,3 +97,48 @@ func (e *Experiment) SetAggregatedBuiltinHists(fortioData v1.JSON) {
 	}
 	abh.Data = fortioData
 }
+
+// SetAggregatedMetric sets the experiment status field corresponding to the value of a metric for a version,
+// and records the given provenance of the aggregated metrics.
+// The max and min values of the metric, for the version and across versions, are updated accordingly.
+func (e *Experiment) SetAggregatedMetric(metric string, version string, value resource.Quantity, provenance string) {
+	if e.Status.Analysis == nil {
+		e.Status.Analysis = &v2alpha2.Analysis{}
+	}
+	if e.Status.Analysis.AggregatedMetrics == nil {
+		e.Status.Analysis.AggregatedMetrics = &v2alpha2.AggregatedMetricsAnalysis{}
+	}
+	am := e.Status.Analysis.AggregatedMetrics
+	am.AnalysisMetaData = v2alpha2.AnalysisMetaData{
+		Provenance: provenance,
+		Timestamp:  metav1.Now(),
+	}
+	if am.Data == nil {
+		am.Data = make(map[string]v2alpha2.AggregatedMetricsData)
+	}
+
+	md := am.Data[metric]
+	if md.Data == nil {
+		md.Data = make(map[string]v2alpha2.AggregatedMetricsVersionData)
+	}
+	vd := md.Data[version]
+	vd.Value = QuantityPointer(value)
+	if vd.Max == nil || value.Cmp(*vd.Max) > 0 {
+		vd.Max = QuantityPointer(value)
+	}
+	if vd.Min == nil || value.Cmp(*vd.Min) < 0 {
+		vd.Min = QuantityPointer(value)
+	}
+	md.Data[version] = vd
+
+	md.Max, md.Min = nil, nil
+	for _, d := range md.Data {
+		if d.Max != nil && (md.Max == nil || d.Max.Cmp(*md.Max) > 0) {
+			md.Max = QuantityPointer(*d.Max)
+		}
+		if d.Min != nil && (md.Min == nil || d.Min.Cmp(*md.Min) < 0) {
+			md.Min = QuantityPointer(*d.Min)
+		}
+	}
+	am.Data[metric] = md
+}
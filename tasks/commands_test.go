@@ -5,6 +5,7 @@ import (
 
 	"github.com/iter8-tools/etc3/api/v2alpha2"
 	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func TestGetActionSpec(t *testing.T) {
@@ -87,3 +88,19 @@ func TestFindVariableVersionDetail(t *testing.T) {
 	assert.Empty(t, val)
 	assert.Error(t, err)
 }
+
+func TestSetAggregatedMetric(t *testing.T) {
+	exp := &Experiment{}
+	exp.SetAggregatedMetric("latency", "baseline", resource.MustParse("10"), "test")
+	exp.SetAggregatedMetric("latency", "candidate", resource.MustParse("5"), "test")
+	exp.SetAggregatedMetric("latency", "baseline", resource.MustParse("20"), "test")
+
+	assert.Equal(t, "test", exp.Status.Analysis.AggregatedMetrics.Provenance)
+	md := exp.Status.Analysis.AggregatedMetrics.Data["latency"]
+	assert.Equal(t, "20", md.Data["baseline"].Value.String())
+	assert.Equal(t, "20", md.Data["baseline"].Max.String())
+	assert.Equal(t, "10", md.Data["baseline"].Min.String())
+	assert.Equal(t, "5", md.Data["candidate"].Value.String())
+	assert.Equal(t, "20", md.Max.String())
+	assert.Equal(t, "5", md.Min.String())
+}
@@ -0,0 +1,106 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	iter8 "github.com/iter8-tools/etc3/api/v2alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EventComponent is the component recorded as the source of events emitted by the handler
+const EventComponent string = "iter8-handler"
+
+// Reasons of events emitted by the handler
+const (
+	// ActionStartedReason is the reason of events emitted when an action starts
+	ActionStartedReason string = "ActionStarted"
+	// ActionCompletedReason is the reason of events emitted when all tasks of an action succeed
+	ActionCompletedReason string = "ActionCompleted"
+	// ActionFailedReason is the reason of events emitted when an action stops due to a failed task
+	ActionFailedReason string = "ActionFailed"
+	// TaskSucceededReason is the reason of events emitted when a task succeeds
+	TaskSucceededReason string = "TaskSucceeded"
+	// TaskFailedReason is the reason of events emitted when a task fails
+	TaskFailedReason string = "TaskFailed"
+	// TaskSkippedReason is the reason of events emitted when a task is skipped
+	TaskSkippedReason string = "TaskSkipped"
+	// TaskFailureIgnoredReason is the reason of events emitted when a task fails but its failure is ignored
+	TaskFailureIgnoredReason string = "TaskFailureIgnored"
+)
+
+// taskOutcome is the outcome of a task beyond its returned error, as reported by the task
+type taskOutcome struct {
+	skipped *string
+	ignored error
+}
+
+// outcomeKey is the context key of the outcome of the running task
+const outcomeKey ContextKey = "taskOutcome"
+
+// ReportSkipped records, in a context passed to Task.Run, that the task was skipped for the given reason.
+func ReportSkipped(ctx context.Context, reason string) {
+	if o, ok := ctx.Value(outcomeKey).(*taskOutcome); ok {
+		o.skipped = &reason
+	}
+}
+
+// ReportIgnoredFailure records, in a context passed to Task.Run, that the task failed with the given error
+// but that the failure is ignored and the task returns no error.
+func ReportIgnoredFailure(ctx context.Context, err error) {
+	if o, ok := ctx.Value(outcomeKey).(*taskOutcome); ok && err != nil {
+		o.ignored = err
+	}
+}
+
+// GetActionNameFromContext gets the name of the running action from given context.
+func GetActionNameFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(ContextKey("action")).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// RecordEvent records a Kubernetes event on the experiment in the given context.
+// Events are best effort; failure to record an event is logged and otherwise ignored.
+// Sensitive values are redacted from the message.
+func RecordEvent(ctx context.Context, eventType string, reason string, message string) {
+	exp, err := GetExperimentFromContext(ctx)
+	if err != nil || exp == nil {
+		log.Debug("no experiment in context; not recording event ", reason)
+		return
+	}
+	c, err := GetClient()
+	if err != nil {
+		log.Warn("unable to record event ", reason, ": ", err)
+		return
+	}
+	now := metav1.NewTime(time.Now())
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", exp.Name, now.UnixNano()),
+			Namespace: exp.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      iter8.GroupVersion.String(),
+			Kind:            "Experiment",
+			Name:            exp.Name,
+			Namespace:       exp.Namespace,
+			UID:             exp.UID,
+			ResourceVersion: exp.ResourceVersion,
+		},
+		Reason:              reason,
+		Message:             Redact(message),
+		Type:                eventType,
+		Source:              corev1.EventSource{Component: EventComponent},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: EventComponent,
+	}
+	if err = c.Create(ctx, event); err != nil {
+		log.Warn("unable to record event ", reason, ": ", err)
+	}
+}
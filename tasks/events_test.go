@@ -0,0 +1,81 @@
+package tasks_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeTask reports the given outcome and returns the given error
+type fakeTask struct {
+	tasks.TaskMeta
+	skip   string
+	ignore error
+	err    error
+}
+
+func (t *fakeTask) Run(ctx context.Context) error {
+	if t.skip != "" {
+		tasks.ReportSkipped(ctx, t.skip)
+	}
+	tasks.ReportIgnoredFailure(ctx, t.ignore)
+	return t.err
+}
+
+func TestActionEvents(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return c, nil
+	}
+
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../", "testdata/experiment10.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+	ctx = context.WithValue(ctx, tasks.ContextKey("action"), "finish")
+
+	action := tasks.Action{
+		&fakeTask{TaskMeta: tasks.TaskMeta{Task: "common/bash"}},
+		&fakeTask{TaskMeta: tasks.TaskMeta{Task: "metrics/query"}, skip: "no versions to query"},
+		&fakeTask{TaskMeta: tasks.TaskMeta{Task: "notification/slack"}, ignore: errors.New("slack is down")},
+		&fakeTask{TaskMeta: tasks.TaskMeta{Library: "common", Task: "exec"}, err: errors.New("exit status 1")},
+		&fakeTask{TaskMeta: tasks.TaskMeta{Task: "common/bash"}},
+	}
+	assert.Error(t, action.Run(ctx))
+
+	events := &corev1.EventList{}
+	assert.NoError(t, c.List(context.Background(), events, client.InNamespace(exp.Namespace)))
+	reasons := []string{}
+	for _, e := range events.Items {
+		assert.Equal(t, "Experiment", e.InvolvedObject.Kind)
+		assert.Equal(t, exp.Name, e.InvolvedObject.Name)
+		assert.Equal(t, tasks.EventComponent, e.Source.Component)
+		reasons = append(reasons, e.Reason)
+		switch e.Reason {
+		case tasks.TaskSkippedReason:
+			assert.Equal(t, corev1.EventTypeNormal, e.Type)
+			assert.Equal(t, "task 1 (metrics/query) of action finish skipped: no versions to query", e.Message)
+		case tasks.TaskFailureIgnoredReason:
+			assert.Equal(t, corev1.EventTypeWarning, e.Type)
+			assert.Contains(t, e.Message, "slack is down")
+		case tasks.TaskFailedReason:
+			assert.Equal(t, corev1.EventTypeWarning, e.Type)
+			assert.Equal(t, "task 3 (common/exec) of action finish failed: exit status 1", e.Message)
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		tasks.ActionStartedReason,
+		tasks.TaskSucceededReason,
+		tasks.TaskSkippedReason,
+		tasks.TaskFailureIgnoredReason,
+		tasks.TaskFailedReason,
+		tasks.ActionFailedReason,
+	}, reasons)
+}
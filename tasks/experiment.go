@@ -92,9 +92,9 @@ func (exp *Experiment) ToMap() (map[string]interface{}, error) {
 	return expObj, nil
 }
 
-// GetSecret retrieves a secret from the kubernetes cluster
-func GetSecret(namespacedname string) (*corev1.Secret, error) {
-	// get secret namespace and name
+// ToNamespacedName splits a name of the form namespace/name; if no namespace is present,
+// the namespace of the experiment is used.
+func ToNamespacedName(namespacedname string) types.NamespacedName {
 	namespace := viper.GetViper().GetString("experiment_namespace")
 	var name string
 	nn := strings.Split(namespacedname, "/")
@@ -104,9 +104,31 @@ func GetSecret(namespacedname string) (*corev1.Secret, error) {
 		namespace = nn[0]
 		name = nn[1]
 	}
-	log.Trace("retrieving secret: ", namespace, "/", name)
+	return types.NamespacedName{Namespace: namespace, Name: name}
+}
+
+// GetSecret retrieves a secret from the kubernetes cluster.
+// The data of the secret is redacted from log output.
+func GetSecret(namespacedname string) (*corev1.Secret, error) {
+	// get secret namespace and name
+	nn := ToNamespacedName(namespacedname)
+	log.Trace("retrieving secret: ", nn.Namespace, "/", nn.Name)
 
 	secret := corev1.Secret{}
-	err := GetTypedObject(&types.NamespacedName{Namespace: namespace, Name: name}, &secret)
+	err := GetTypedObject(&nn, &secret)
+	for _, v := range secret.Data {
+		AddSensitiveValues(string(v))
+	}
 	return &secret, err
 }
+
+// GetConfigMap retrieves a config map from the kubernetes cluster
+func GetConfigMap(namespacedname string) (*corev1.ConfigMap, error) {
+	// get config map namespace and name
+	nn := ToNamespacedName(namespacedname)
+	log.Trace("retrieving config map: ", nn.Namespace, "/", nn.Name)
+
+	cm := corev1.ConfigMap{}
+	err := GetTypedObject(&nn, &cm)
+	return &cm, err
+}
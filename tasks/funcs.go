@@ -0,0 +1,317 @@
+package tasks
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// FuncMap returns the functions available in templates interpolated by Tags.
+// The functions follow the naming and argument order of the sprig library, so that the value operated on
+// can be piped in as the last argument, as in {{ .revision | default "latest" | quote }}.
+// Functions that access the environment, the file system or the network are deliberately not included.
+func FuncMap() map[string]interface{} {
+	return map[string]interface{}{
+		// strings
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"title":      strings.Title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix string, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix string, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old string, new string, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(substr string, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix string, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix string, s string) bool { return strings.HasSuffix(s, suffix) },
+		"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+		"trunc":      trunc,
+		"indent":     indent,
+		"nindent":    func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+		"split":      func(sep string, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+		"toString":   toString,
+
+		// lists and dictionaries
+		"list":   func(items ...interface{}) []interface{} { return items },
+		"first":  first,
+		"last":   last,
+		"has":    has,
+		"dict":   dict,
+		"get":    get,
+		"hasKey": func(d map[string]interface{}, key string) bool { _, ok := d[key]; return ok },
+		"keys":   keys,
+
+		// defaults
+		"default":  defaultValue,
+		"empty":    empty,
+		"coalesce": coalesce,
+		"ternary": func(t interface{}, f interface{}, condition bool) interface{} {
+			if condition {
+				return t
+			}
+			return f
+		},
+		"required": required,
+
+		// encoding
+		"toJson":       toJSON,
+		"toPrettyJson": toPrettyJSON,
+		"fromJson":     fromJSON,
+		"toYaml":       toYAML,
+		"b64enc":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec":       b64dec,
+
+		// quoting and escaping
+		"quote":      func(v interface{}) string { return strconv.Quote(toString(v)) },
+		"squote":     func(v interface{}) string { return "'" + toString(v) + "'" },
+		"shellQuote": func(v interface{}) string { return shellQuote(toString(v)) },
+
+		// regular expressions
+		"regexMatch":      regexMatch,
+		"regexFind":       regexFind,
+		"regexFindAll":    regexFindAll,
+		"regexReplaceAll": regexReplaceAll,
+	}
+}
+
+// toString converts a value to a string; nil is converted to the empty string
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case fmt.Stringer:
+		return s.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// trunc truncates a string to at most length characters; multi-byte characters are not split
+func trunc(length int, s string) string {
+	if length < 0 {
+		return s
+	}
+	if r := []rune(s); len(r) > length {
+		return string(r[:length])
+	}
+	return s
+}
+
+// indent indents each line of a string by the given number of spaces
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// toList converts a slice or array to a list
+func toList(list interface{}) ([]interface{}, error) {
+	if list == nil {
+		return nil, nil
+	}
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected a list but got %T", list)
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// join joins the items of a list using the separator
+func join(sep string, list interface{}) (string, error) {
+	items, err := toList(list)
+	if err != nil {
+		return "", err
+	}
+	s := make([]string, len(items))
+	for i, item := range items {
+		s[i] = toString(item)
+	}
+	return strings.Join(s, sep), nil
+}
+
+// first returns the first item of a list, or nil if the list is empty
+func first(list interface{}) (interface{}, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// last returns the last item of a list, or nil if the list is empty
+func last(list interface{}) (interface{}, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+// has returns true if the list contains the item
+func has(item interface{}, list interface{}) (bool, error) {
+	items, err := toList(list)
+	if err != nil {
+		return false, err
+	}
+	for _, i := range items {
+		if reflect.DeepEqual(i, item) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// dict creates a dictionary from alternating keys and values
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict requires an even number of arguments")
+	}
+	d := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		d[toString(pairs[i])] = pairs[i+1]
+	}
+	return d, nil
+}
+
+// get returns the value of a key of a dictionary, or the empty string if there is no such key
+func get(d map[string]interface{}, key string) interface{} {
+	if v, ok := d[key]; ok {
+		return v
+	}
+	return ""
+}
+
+// keys returns the sorted keys of a dictionary
+func keys(d map[string]interface{}) []string {
+	k := make([]string, 0, len(d))
+	for key := range d {
+		k = append(k, key)
+	}
+	sort.Strings(k)
+	return k
+}
+
+// empty returns true if the value is nil, or the zero value of its type, or an empty collection
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return rv.IsZero()
+	}
+}
+
+// defaultValue returns the value, or the default if the value is empty
+func defaultValue(d interface{}, v ...interface{}) interface{} {
+	if len(v) == 0 || empty(v[0]) {
+		return d
+	}
+	return v[0]
+}
+
+// coalesce returns the first value that is not empty
+func coalesce(v ...interface{}) interface{} {
+	for _, value := range v {
+		if !empty(value) {
+			return value
+		}
+	}
+	return nil
+}
+
+// required returns the value, or an error with the given message if the value is empty
+func required(msg string, v interface{}) (interface{}, error) {
+	if empty(v) {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+// toJSON encodes a value as JSON
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// toPrettyJSON encodes a value as indented JSON
+func toPrettyJSON(v interface{}) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	return string(b), err
+}
+
+// fromJSON decodes a JSON string
+func fromJSON(s string) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
+
+// toYAML encodes a value as YAML
+func toYAML(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	return strings.TrimSuffix(string(b), "\n"), err
+}
+
+// b64dec decodes a base64 encoded string
+func b64dec(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	return string(b), err
+}
+
+// shellQuote quotes a string so that it is interpreted literally as a single word by POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// regexMatch returns true if the string matches the regular expression
+func regexMatch(re string, s string) (bool, error) {
+	return regexp.MatchString(re, s)
+}
+
+// regexFind returns the first match of the regular expression in the string
+func regexFind(re string, s string) (string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return "", err
+	}
+	return r.FindString(s), nil
+}
+
+// regexFindAll returns up to n matches of the regular expression in the string; all matches if n is negative
+func regexFindAll(re string, s string, n int) ([]string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return nil, err
+	}
+	return r.FindAllString(s, n), nil
+}
+
+// regexReplaceAll replaces matches of the regular expression in the string; the replacement may refer to submatches such as $1
+func regexReplaceAll(re string, s string, repl string) (string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return "", err
+	}
+	return r.ReplaceAllString(s, repl), nil
+}
@@ -3,15 +3,20 @@ package tasks
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	iter8 "github.com/iter8-tools/etc3/api/v2alpha2"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 
@@ -26,9 +31,32 @@ func Resource(resource string) schema.GroupResource {
 	return iter8.GroupVersion.WithResource(resource).GroupResource()
 }
 
+// ClientOptions configure the Kubernetes client used by tasks.
+type ClientOptions struct {
+	// Context is the kubeconfig context used to connect to the cluster; the current context if empty
+	Context string
+	// QPS is the maximum rate of requests to the API server; the client-go default if zero
+	QPS float32
+	// Burst is the maximum burst of requests to the API server; the client-go default if zero
+	Burst int
+	// Impersonate is the user impersonated in requests to the API server; no user is impersonated if empty
+	Impersonate string
+	// ImpersonateGroups are the groups impersonated in requests to the API server
+	ImpersonateGroups []string
+}
+
+var clientOptions ClientOptions
+
+// SetClientOptions configures the Kubernetes client used by tasks.
+// The client is created again when it is next used.
+func SetClientOptions(opts ClientOptions) {
+	clientOptions = opts
+	ResetClient()
+}
+
 // GetConfig variable is useful for test mocks.
 var GetConfig = func() (*rest.Config, error) {
-	return config.GetConfig()
+	return config.GetConfigWithContext(clientOptions.Context)
 }
 
 // NumAttempt is the number of times to attempt Get operation for a k8s resource
@@ -37,11 +65,67 @@ var NumAttempt = 10
 // Period is the time duration between between each attempt
 var Period = 18 * time.Second
 
-// GetClient constructs and returns a K8s client.
+// Timeout bounds the time taken by an operation on a k8s resource, including its attempts
+var Timeout = 3 * time.Minute
+
+// cachedClient is the client returned by GetClient; it is created when first used
+var cachedClient = struct {
+	sync.Mutex
+	c client.Client
+}{}
+
+// ResetClient discards the clients returned by GetClient and GetDynamicClient, so that they are created again when next used.
+func ResetClient() {
+	cachedClient.Lock()
+	cachedClient.c = nil
+	cachedClient.Unlock()
+	resetDynamicClient()
+}
+
+// GetClient returns a K8s client, which is created when first used and reused afterwards.
 // The returned client has experiment.Experiment type registered.
-var GetClient = func() (rc client.Client, err error) {
+var GetClient = func() (client.Client, error) {
+	cachedClient.Lock()
+	defer cachedClient.Unlock()
+	if cachedClient.c == nil {
+		rc, err := newClient()
+		if err != nil {
+			return nil, err
+		}
+		cachedClient.c = rc
+	}
+	return cachedClient.c, nil
+}
+
+// restConfig returns the rest config of K8s clients, with the client options applied.
+func restConfig() (*rest.Config, error) {
+	restConf, err := GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	// the config is copied since it may be shared
+	restConf = rest.CopyConfig(restConf)
+	if clientOptions.QPS > 0 {
+		restConf.QPS = clientOptions.QPS
+	}
+	if clientOptions.Burst > 0 {
+		restConf.Burst = clientOptions.Burst
+	}
+	if clientOptions.Impersonate != "" || len(clientOptions.ImpersonateGroups) > 0 {
+		restConf.Impersonate = rest.ImpersonationConfig{
+			UserName: clientOptions.Impersonate,
+			Groups:   clientOptions.ImpersonateGroups,
+		}
+	}
+	// trace Kubernetes API calls
+	restConf.Wrap(TracedTransport)
+	return restConf, nil
+}
+
+// newClient constructs a K8s client using the client options.
+func newClient() (rc client.Client, err error) {
 	var restConf *rest.Config
-	restConf, err = GetConfig()
+	restConf, err = restConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -60,7 +144,7 @@ var GetClient = func() (rc client.Client, err error) {
 			Version: "v1",
 		}
 		metav1.AddToGroupVersion(scheme, gv)
-		scheme.AddKnownTypes(gv, &corev1.Secret{})
+		scheme.AddKnownTypes(gv, &corev1.Secret{}, &corev1.ConfigMap{}, &corev1.Event{})
 
 		// Support for deployments
 		metav1.AddToGroupVersion(scheme, appsv1.SchemeGroupVersion)
@@ -111,36 +195,108 @@ func (b *Builder) FromCluster(nn *client.ObjectKey) *Builder {
 	return b
 }
 
-// GetTypedObject gets a typed object from the k8s cluster. Types of such objects include experiment, knative service, etc. This function attempts to get the object `numAttempts` times, with the interval between attempts equal to `period`.
+// transient returns true if an error of an operation on a k8s resource may not recur if the operation is attempted again
+func transient(err error) bool {
+	switch {
+	case apierrors.IsNotFound(err), apierrors.IsForbidden(err), apierrors.IsUnauthorized(err),
+		apierrors.IsBadRequest(err), apierrors.IsInvalid(err), apierrors.IsMethodNotSupported(err),
+		meta.IsNoMatchError(err), runtime.IsNotRegisteredError(err):
+		return false
+	}
+	return true
+}
+
+// GetTypedObject gets a typed object from the k8s cluster. Types of such objects include experiment, knative service, etc.
+// See GetTypedObjectWithContext; the operation is bounded by Timeout.
 func GetTypedObject(nn *client.ObjectKey, obj client.Object) error {
-	var err = errors.New("unable to get object from cluster")
-	var rc client.Client
-	if rc, err = GetClient(); err == nil {
-		for i := 0; i < NumAttempt; i++ {
-			err = rc.Get(context.Background(), *nn, obj)
-			if err == nil {
-				break
-			}
-			time.Sleep(Period)
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	return GetTypedObjectWithContext(ctx, nn, obj)
+}
+
+// GetTypedObjectWithContext gets a typed object from the k8s cluster.
+// This function attempts to get the object up to `NumAttempt` times, with the interval between attempts equal to `Period`,
+// until the deadline of the context. Errors that would recur, such as the object not being found or access being forbidden, are not retried.
+func GetTypedObjectWithContext(ctx context.Context, nn *client.ObjectKey, obj client.Object) error {
+	rc, err := GetClient()
+	if err != nil {
+		return err
 	}
-	return err
+	return retryTransient(ctx, fmt.Sprintf("get object %s", nn), func() error {
+		return rc.Get(ctx, *nn, obj)
+	})
 }
 
-// UpdateInClusterExperiment updates the experiment within cluster.
-func UpdateInClusterExperiment(e *Experiment) (err error) {
-	var c client.Client
-	if c, err = GetClient(); err == nil {
-		err = c.Update(context.Background(), e)
+// retryTransient attempts an operation on a k8s resource up to `NumAttempt` times, with the interval between attempts equal to `Period`,
+// until the deadline of the context. Only transient errors are retried.
+func retryTransient(ctx context.Context, operation string, f func() error) error {
+	var err error
+	for i := 0; i < NumAttempt; i++ {
+		err = f()
+		if err == nil || !transient(err) || i == NumAttempt-1 {
+			break
+		}
+		log.Warn("unable to ", operation, ": ", err, "; retrying in ", Period)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("unable to %s: %v", operation, err)
+		case <-time.After(Period):
+		}
 	}
 	return err
 }
 
-// UpdateInClusterExperimentStatus updates the experiment status within cluster.
-func UpdateInClusterExperimentStatus(e *Experiment) (err error) {
-	var c client.Client
-	if c, err = GetClient(); err == nil {
-		err = c.Status().Update(context.Background(), e)
+// Mutation applies the changes made by a task to an experiment.
+type Mutation func(exp *Experiment) error
+
+// updateInCluster applies mutate to the latest version of the experiment within cluster, and writes it using write.
+// Since etc3 reconciles the same experiment, the experiment is fetched again and mutated on each attempt,
+// so that only the fields changed by mutate are written, and the write is retried if it conflicts with a change made by etc3.
+// On success, e is set to the updated experiment.
+func updateInCluster(e *Experiment, mutate Mutation, write func(context.Context, client.Client, *Experiment) error) error {
+	rc, err := GetClient()
+	if err != nil {
+		return err
 	}
-	return err
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	nn := client.ObjectKeyFromObject(e)
+	latest := &Experiment{}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest = &Experiment{}
+		if err := GetTypedObjectWithContext(ctx, &nn, latest); err != nil {
+			return err
+		}
+		if err := mutate(latest); err != nil {
+			return err
+		}
+		err := write(ctx, rc, latest)
+		if apierrors.IsConflict(err) {
+			log.Trace("experiment ", nn, " changed since it was fetched; retrying update")
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	e.Experiment = latest.Experiment
+	return nil
+}
+
+// UpdateInClusterExperiment applies mutate to the experiment within cluster, and updates it.
+// The experiment is fetched again before mutate is applied, and the update is retried on conflict.
+// On success, e is set to the updated experiment.
+func UpdateInClusterExperiment(e *Experiment, mutate Mutation) error {
+	return updateInCluster(e, mutate, func(ctx context.Context, rc client.Client, exp *Experiment) error {
+		return rc.Update(ctx, exp)
+	})
+}
+
+// UpdateInClusterExperimentStatus applies mutate to the experiment within cluster, and updates its status.
+// The experiment is fetched again before mutate is applied, and the update is retried on conflict.
+// On success, e is set to the updated experiment.
+func UpdateInClusterExperimentStatus(e *Experiment, mutate Mutation) error {
+	return updateInCluster(e, mutate, func(ctx context.Context, rc client.Client, exp *Experiment) error {
+		return rc.Status().Update(ctx, exp)
+	})
 }
@@ -0,0 +1,180 @@
+package tasks_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// experimentClient stores an experiment, which is changed after the handler fetches it, as etc3 may do while a task runs
+type experimentClient struct {
+	client.Client
+	exp        v2alpha2.Experiment
+	reconciles int
+}
+
+func (c *experimentClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	c.exp.DeepCopyInto(&obj.(*tasks.Experiment).Experiment)
+	if c.reconciles > 0 {
+		c.reconciles--
+		message := "reconciled by etc3"
+		c.exp.Status.Message = &message
+		c.bump()
+	}
+	return nil
+}
+
+func (c *experimentClient) bump() {
+	rv, _ := strconv.Atoi(c.exp.ResourceVersion)
+	c.exp.ResourceVersion = strconv.Itoa(rv + 1)
+}
+
+func (c *experimentClient) Status() client.StatusWriter {
+	return c
+}
+
+func (c *experimentClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	exp := obj.(*tasks.Experiment)
+	if exp.ResourceVersion != c.exp.ResourceVersion {
+		return apierrors.NewConflict(schema.GroupResource{Group: "iter8.tools", Resource: "experiments"}, exp.Name, nil)
+	}
+	exp.DeepCopyInto(&c.exp)
+	c.bump()
+	exp.ResourceVersion = c.exp.ResourceVersion
+	return nil
+}
+
+func TestUpdateInClusterExperimentStatusConflict(t *testing.T) {
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	exp.ResourceVersion = "1"
+	rc := &experimentClient{exp: *exp.Experiment.DeepCopy(), reconciles: 2}
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return rc, nil
+	}
+
+	mutations := 0
+	assert.NoError(t, tasks.UpdateInClusterExperimentStatus(exp, func(e *tasks.Experiment) error {
+		mutations++
+		e.SetAggregatedBuiltinHists(v1.JSON{Raw: []byte(`{"baseline":{}}`)})
+		return nil
+	}))
+	// the experiment is fetched and mutated again after each conflict
+	assert.Equal(t, 3, mutations)
+
+	// both the changes of etc3 and of the handler are kept
+	assert.Equal(t, "reconciled by etc3", *rc.exp.Status.Message)
+	assert.JSONEq(t, `{"baseline":{}}`, string(rc.exp.Status.Analysis.AggregatedBuiltinHists.Data.Raw))
+	// and the experiment is set to the updated one
+	assert.Equal(t, rc.exp.ResourceVersion, exp.ResourceVersion)
+	assert.Equal(t, "reconciled by etc3", *exp.Status.Message)
+}
+
+// apiServer serves discovery, and secrets with the given status, counting the requests for each secret
+func apiServer(t *testing.T, status map[string]int, requests map[string]int, header http.Header, lock *sync.Mutex) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var body interface{}
+		switch r.URL.Path {
+		case "/api":
+			body = metav1.APIVersions{Versions: []string{"v1"}}
+		case "/apis":
+			body = metav1.APIGroupList{}
+		case "/api/v1":
+			body = metav1.APIResourceList{GroupVersion: "v1", APIResources: []metav1.APIResource{
+				{Name: "secrets", Namespaced: true, Kind: "Secret", Verbs: metav1.Verbs{"get"}},
+			}}
+		default:
+			name := r.URL.Path[len("/api/v1/namespaces/default/secrets/"):]
+			lock.Lock()
+			requests[name]++
+			for k, v := range r.Header {
+				header[k] = v
+			}
+			lock.Unlock()
+			if status[name] == http.StatusOK {
+				body = corev1.Secret{TypeMeta: metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"}, ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+			} else {
+				w.WriteHeader(status[name])
+				body = &metav1.Status{TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}, Status: metav1.StatusFailure, Code: int32(status[name]),
+					Reason: metav1.StatusReason(http.StatusText(status[name])), Details: &metav1.StatusDetails{Name: name, Kind: "secrets"}}
+				if status[name] == http.StatusNotFound {
+					body.(*metav1.Status).Reason = metav1.StatusReasonNotFound
+				}
+			}
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(body))
+	}))
+}
+
+func TestGetTypedObjectRetries(t *testing.T) {
+	status := map[string]int{"found": http.StatusOK, "missing": http.StatusNotFound, "forbidden": http.StatusForbidden, "unavailable": http.StatusServiceUnavailable}
+	requests := map[string]int{}
+	header := http.Header{}
+	lock := &sync.Mutex{}
+	server := apiServer(t, status, requests, header, lock)
+	defer server.Close()
+
+	getConfig, numAttempt, period := tasks.GetConfig, tasks.NumAttempt, tasks.Period
+	defer func() {
+		tasks.GetConfig, tasks.NumAttempt, tasks.Period = getConfig, numAttempt, period
+		tasks.SetClientOptions(tasks.ClientOptions{})
+	}()
+	tasks.GetConfig = func() (*rest.Config, error) {
+		return &rest.Config{Host: server.URL}, nil
+	}
+	tasks.NumAttempt, tasks.Period = 3, time.Millisecond
+	tasks.SetClientOptions(tasks.ClientOptions{QPS: 100, Burst: 200, Impersonate: "iter8-handler", ImpersonateGroups: []string{"iter8"}})
+
+	// the client is reused
+	c1, err := tasks.GetClient()
+	assert.NoError(t, err)
+	c2, err := tasks.GetClient()
+	assert.NoError(t, err)
+	assert.Same(t, c1, c2)
+
+	for name, s := range status {
+		err := tasks.GetTypedObject(&client.ObjectKey{Namespace: "default", Name: name}, &corev1.Secret{})
+		if s == http.StatusOK {
+			assert.NoError(t, err)
+		} else {
+			assert.Error(t, err, name)
+		}
+	}
+	// only transient errors are retried
+	assert.Equal(t, map[string]int{"found": 1, "missing": 1, "forbidden": 1, "unavailable": 3}, requests)
+	assert.Equal(t, "iter8-handler", header.Get("Impersonate-User"))
+	assert.Equal(t, "iter8", header.Get("Impersonate-Group"))
+
+	// retries stop at the deadline of the context
+	tasks.Period = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(t, tasks.GetTypedObjectWithContext(ctx, &client.ObjectKey{Namespace: "default", Name: "unavailable"}, &corev1.Secret{}))
+	assert.Less(t, int64(time.Since(start)), int64(10*time.Second))
+
+	// the client is created again when options change
+	tasks.SetClientOptions(tasks.ClientOptions{})
+	c3, err := tasks.GetClient()
+	assert.NoError(t, err)
+	assert.NotSame(t, c1, c3)
+}
@@ -54,23 +54,17 @@ func (t *BashTask) Run(ctx context.Context) error {
 	}
 	log.Trace("experiment", exp)
 
-	obj, err := exp.ToMap()
-	if err != nil {
-		// error already logged by ToMap()
-		// don't log it again
-		return err
-	}
-
-	// prepare for interpolation; add experiment as tag
+	// prepare for interpolation using the data model common to all tasks
 	// Note that if versionRecommendedForPromotion is not set or there is no version corresponding to it,
 	// then some placeholders may not be replaced
-	tags := tasks.NewTags().
-		With("this", obj).
-		WithRecommendedVersionForPromotion(&exp.Experiment)
-	log.Tracef("tags: %v", tags)
+	tags := tasks.ExperimentTags(ctx, exp)
 
 	// interpolate - replaces placeholders in the script with values
 	script, err := tags.Interpolate(&t.With.Script)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
 
 	log.Trace(script)
 	args := []string{"-c", script}
@@ -80,7 +74,7 @@ func (t *BashTask) Run(ctx context.Context) error {
 	cmd.Stderr = os.Stderr
 	log.Info("Running task: " + cmd.String())
 	log.Trace(args)
-	err = cmd.Run()
+	err = tasks.RunCommand(ctx, cmd)
 
 	return err
 }
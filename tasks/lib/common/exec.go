@@ -3,6 +3,7 @@ package common
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -38,11 +39,9 @@ func (t *ExecTask) Run(ctx context.Context) error {
 			inputArgs[i] = fmt.Sprint(t.With.Args[i])
 		}
 		log.Trace(inputArgs)
-		var args []string
-		if t.With.DisableInterpolation {
-			args = inputArgs
-		} else {
-			args, err = exp.Interpolate(inputArgs)
+		args := inputArgs
+		if !t.With.DisableInterpolation {
+			args, err = interpolateArgs(ctx, exp, inputArgs)
 		}
 		if err == nil {
 			log.Trace("interpolated args: ", args)
@@ -51,7 +50,7 @@ func (t *ExecTask) Run(ctx context.Context) error {
 			cmd.Stderr = os.Stderr
 			log.Info("Running task: " + cmd.String())
 			log.Trace(args)
-			err = cmd.Run()
+			err = tasks.RunCommand(ctx, cmd)
 		}
 	}
 	if err != nil {
@@ -60,6 +59,23 @@ func (t *ExecTask) Run(ctx context.Context) error {
 	return err
 }
 
+// interpolateArgs interpolates arguments using the data model common to all tasks
+func interpolateArgs(ctx context.Context, exp *tasks.Experiment, inputArgs []string) ([]string, error) {
+	if exp == nil {
+		return nil, errors.New("cannot interpolate arguments without an experiment")
+	}
+	tags := tasks.ExperimentTags(ctx, exp)
+	args := make([]string, len(inputArgs))
+	for i := range inputArgs {
+		var err error
+		if args[i], err = tags.Interpolate(&inputArgs[i]); err != nil {
+			return nil, err
+		}
+		log.Trace("input arg: ", inputArgs[i], " interpolated arg: ", args[i])
+	}
+	return args, nil
+}
+
 // MakeExec converts an exec task spec into an exec task.
 func MakeExec(t *v2alpha2.TaskSpec) (tasks.Task, error) {
 	if t.Task != LibraryName+"/"+ExecTaskName {
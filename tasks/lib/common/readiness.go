@@ -129,6 +129,14 @@ var getCommand = func(name string, arg ...string) command {
 	return exec.Command(name, arg...)
 }
 
+// runCommand runs a command, tracing it if it is a subprocess
+func runCommand(ctx context.Context, cmd command) error {
+	if c, ok := cmd.(*exec.Cmd); ok {
+		return tasks.RunCommand(ctx, c)
+	}
+	return cmd.Run()
+}
+
 // Run checks existence and readiness of K8s objects.
 func (t *ReadinessTask) Run(ctx context.Context) error {
 	exp, err := tasks.GetExperimentFromContext(ctx)
@@ -190,7 +198,7 @@ func (t *ReadinessTask) Run(ctx context.Context) error {
 			}
 
 			log.Info("Executing command: " + cmd.String())
-			err = cmd.Run()
+			err = runCommand(ctx, cmd)
 			if err == nil {
 				// check readiness condition if any
 				if t.With.ObjRefs[i].WaitFor != nil {
@@ -204,7 +212,7 @@ func (t *ReadinessTask) Run(ctx context.Context) error {
 					}
 
 					log.Info("Executing command: " + cmd.String())
-					err = cmd.Run()
+					err = runCommand(ctx, cmd)
 				}
 			}
 
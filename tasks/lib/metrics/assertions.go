@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/iter8-tools/handler/tasks"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// JSONPathAssertion asserts that the value at a JSON path within the response body equals a given value
+type JSONPathAssertion struct {
+	// JSON path within the response body, such as .status or {.items[0].name}
+	Path string `json:"path" yaml:"path"`
+	// expected value at the JSON path
+	Value string `json:"value" yaml:"value"`
+}
+
+// DefaultAssertionQPS is the default rate at which responses of a version are checked against its assertions
+const DefaultAssertionQPS float32 = 1
+
+// safeMethods are the HTTP methods that do not change the state of a version;
+// assertions may only be checked for requests with these methods, since checking them sends extra requests
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+// Assertions are checks on the responses of a version.
+//
+// Fortio, which generates the load, does not expose responses. So assertions are NOT checked against the responses
+// to the load: the task sends EXTRA requests of its own to the version, at the rate given by QPS, and checks their responses.
+// These are counted separately from the requests of Fortio, and the assertion error rate is computed from them alone.
+// Since these requests are in addition to the load, assertions may only be used if every request of the version
+// uses a safe method (GET, HEAD or OPTIONS); this is checked when the task is validated.
+//
+// A checked response that fails any of these checks is counted as an assertion error.
+type Assertions struct {
+	// how many EXTRA requests per second are sent to check the responses of the version; optional; default 1
+	QPS *float32 `json:"qps,omitempty" yaml:"qps,omitempty"`
+	// response body must contain this string; optional
+	BodyContains *string `json:"bodyContains,omitempty" yaml:"bodyContains,omitempty"`
+	// response body must match this regular expression; optional
+	BodyRegex *string `json:"bodyRegex,omitempty" yaml:"bodyRegex,omitempty"`
+	// values that must be present at JSON paths within the response body; optional
+	JSONPathEquals []JSONPathAssertion `json:"jsonPathEquals,omitempty" yaml:"jsonPathEquals,omitempty"`
+	// names of headers that must be present in the response; optional
+	HeadersPresent []string `json:"headersPresent,omitempty" yaml:"headersPresent,omitempty"`
+	// maximum size of the response body in bytes; optional
+	MaxResponseSize *int64 `json:"maxResponseSize,omitempty" yaml:"maxResponseSize,omitempty"`
+}
+
+// compiledAssertions holds assertions whose expressions have been parsed
+type compiledAssertions struct {
+	*Assertions
+	bodyRegex *regexp.Regexp
+	jsonPaths []*jsonpath.JSONPath
+}
+
+// compile parses the regular expression and JSON paths of the assertions
+func (a *Assertions) compile() (*compiledAssertions, error) {
+	ca := &compiledAssertions{Assertions: a}
+	var err error
+	if a.BodyRegex != nil {
+		if ca.bodyRegex, err = regexp.Compile(*a.BodyRegex); err != nil {
+			return nil, err
+		}
+	}
+	for _, jp := range a.JSONPathEquals {
+		p := jsonpath.New(jp.Path)
+		if err = p.Parse(tasks.JSONPathTemplate(jp.Path)); err != nil {
+			return nil, err
+		}
+		ca.jsonPaths = append(ca.jsonPaths, p)
+	}
+	return ca, nil
+}
+
+// check returns an error describing the first assertion that the response fails, if any.
+// The body may be truncated to MaxResponseSize + 1 bytes, and size is the number of bytes in the full body.
+func (ca *compiledAssertions) check(header http.Header, body []byte, size int64) error {
+	if ca.MaxResponseSize != nil && size > *ca.MaxResponseSize {
+		return fmt.Errorf("response size %d exceeds %d", size, *ca.MaxResponseSize)
+	}
+	for _, h := range ca.HeadersPresent {
+		if len(header.Values(h)) == 0 {
+			return fmt.Errorf("header %s not present in response", h)
+		}
+	}
+	if ca.BodyContains != nil && !bytes.Contains(body, []byte(*ca.BodyContains)) {
+		return fmt.Errorf("response body does not contain %s", *ca.BodyContains)
+	}
+	if ca.bodyRegex != nil && !ca.bodyRegex.Match(body) {
+		return fmt.Errorf("response body does not match %s", *ca.BodyRegex)
+	}
+	if len(ca.jsonPaths) > 0 {
+		var obj interface{}
+		if err := json.Unmarshal(body, &obj); err != nil {
+			return errors.New("response body is not valid JSON")
+		}
+		for i, p := range ca.jsonPaths {
+			buf := new(bytes.Buffer)
+			if err := p.Execute(buf, obj); err != nil {
+				return err
+			}
+			if buf.String() != ca.JSONPathEquals[i].Value {
+				return fmt.Errorf("value %s at %s does not equal %s", buf.String(), ca.JSONPathEquals[i].Path, ca.JSONPathEquals[i].Value)
+			}
+		}
+	}
+	return nil
+}
+
+// validateAssertionMethods checks that every request of a version with assertions uses a safe method,
+// since checking the assertions repeats these requests
+func (t *CollectTask) validateAssertionMethods(v *Version) error {
+	if v.Assertions == nil {
+		return nil
+	}
+	payload := t.With.Payload != nil || t.With.PayloadURL != nil || t.With.PayloadConfigMap != nil || t.With.ContentType != nil
+	requests := v.Requests
+	if len(requests) == 0 {
+		requests = []Request{{}}
+	}
+	for _, r := range requests {
+		// the method is chosen as in checkResponse
+		method := http.MethodGet
+		if payload || r.Payload != nil {
+			method = http.MethodPost
+		}
+		if v.Method != nil {
+			method = *v.Method
+		}
+		if r.Method != nil {
+			method = *r.Method
+		}
+		if !safeMethods[strings.ToUpper(method)] {
+			return fmt.Errorf("assertions of version %s require requests with GET, HEAD or OPTIONS, since checking them sends extra requests; found %s", v.Name, method)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssertions(t *testing.T) {
+	a := &Assertions{
+		BodyContains: tasks.StringPointer("ok"),
+		BodyRegex:    tasks.StringPointer(`"code":\s*0`),
+		JSONPathEquals: []JSONPathAssertion{{
+			Path:  ".status",
+			Value: "ok",
+		}, {
+			Path:  "{.items[0].name}",
+			Value: "first",
+		}},
+		HeadersPresent:  []string{"x-request-id"},
+		MaxResponseSize: func(i int64) *int64 { return &i }(100),
+	}
+	ca, err := a.compile()
+	assert.NoError(t, err)
+
+	header := http.Header{}
+	header.Set("X-Request-Id", "1")
+	body := []byte(`{"status": "ok", "code": 0, "items": [{"name": "first"}]}`)
+	assert.NoError(t, ca.check(header, body, int64(len(body))))
+
+	// response too large
+	assert.Error(t, ca.check(header, body, 101))
+
+	// missing header
+	assert.Error(t, ca.check(http.Header{}, body, int64(len(body))))
+
+	// semantic error in payload
+	body = []byte(`{"status": "ok", "code": 1, "items": [{"name": "first"}]}`)
+	assert.Error(t, ca.check(header, body, int64(len(body))))
+
+	// wrong value at JSON path
+	a.BodyRegex = nil
+	ca, err = a.compile()
+	assert.NoError(t, err)
+	body = []byte(`{"status": "ok", "items": [{"name": "second"}]}`)
+	assert.Error(t, ca.check(header, body, int64(len(body))))
+
+	// not JSON
+	body = []byte(`ok`)
+	assert.Error(t, ca.check(header, body, int64(len(body))))
+
+	// invalid expressions
+	_, err = (&Assertions{BodyRegex: tasks.StringPointer("(")}).compile()
+	assert.Error(t, err)
+	_, err = (&Assertions{JSONPathEquals: []JSONPathAssertion{{Path: "{.items[}"}}}).compile()
+	assert.Error(t, err)
+}
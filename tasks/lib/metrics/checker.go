@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/sirupsen/logrus"
+)
+
+// Fortio does not expose responses, which are needed to check assertions. So, for versions with assertions,
+// the handler sends EXTRA requests of its own (at the rate given by Assertions.QPS) while Fortio generates load,
+// and checks their responses. These extra requests add to the load on the version, and are not included in the
+// results of Fortio; assertion errors are therefore counted over a different sample than the other built-in metrics.
+// Only requests with safe methods are allowed for versions with assertions (see validateAssertionMethods).
+
+// assertionResult is the number of responses that were checked against the assertions of a version, and the number that failed them
+type assertionResult struct {
+	checks int
+	errors int
+}
+
+// httpClient constructs an HTTP client that honors the request options of a given version
+func (t *CollectTask) httpClient(j int) (*http.Client, error) {
+	v := t.With.Versions[j]
+	options := t.requestOptions(j)
+
+	data, err := tlsData(&v)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := tasks.TLSConfig(data, options.InsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS options of version %s: %s", v.Name, err.Error())
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.ForceAttemptHTTP2 = options.HTTP2
+	if !options.HTTP2 {
+		// a non-nil, empty map disables HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	client := &http.Client{Transport: transport}
+	if options.Timeout != "" {
+		if client.Timeout, err = time.ParseDuration(options.Timeout); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// payloadForRequest returns the payload of the request, if any
+func payloadForRequest(req *fortioRequest) ([]byte, error) {
+	if req.payload != nil {
+		return []byte(*req.payload), nil
+	}
+	if req.payloadFile != "" {
+		return ioutil.ReadFile(req.payloadFile)
+	}
+	return nil, nil
+}
+
+// checkResponse sends a request and checks its response against the assertions.
+// It returns false if the response was not checked, since the request failed or its status code is 400 or above;
+// such responses are already counted as errors through the return codes of the results of Fortio.
+func (t *CollectTask) checkResponse(entry *logrus.Entry, client *http.Client, assertions *compiledAssertions, req *fortioRequest) (checked bool, err error) {
+	payload, err := payloadForRequest(req)
+	if err != nil {
+		return false, err
+	}
+	method := http.MethodGet
+	if payload != nil || t.With.ContentType != nil {
+		method = http.MethodPost
+	}
+	if req.method != nil {
+		method = *req.method
+	}
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	httpReq, err := http.NewRequest(method, req.url, body)
+	if err != nil {
+		return false, err
+	}
+	for header, value := range req.headers {
+		if strings.EqualFold(header, "Host") {
+			httpReq.Host = value
+		} else {
+			httpReq.Header.Set(header, value)
+		}
+	}
+	if t.With.ContentType != nil {
+		httpReq.Header.Set("Content-Type", *t.With.ContentType)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		entry.Debug(err)
+		return false, nil
+	}
+	defer resp.Body.Close()
+	limit := int64(math.MaxInt64)
+	if assertions.MaxResponseSize != nil {
+		limit = *assertions.MaxResponseSize + 1
+	}
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		entry.Debug(err)
+		return false, nil
+	}
+	rest, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		entry.Debug(err)
+		return false, nil
+	}
+	if resp.StatusCode >= 400 {
+		return false, nil
+	}
+	return true, assertions.check(resp.Header, respBody, int64(len(respBody))+rest)
+}
+
+// checkAssertions sends the requests of a version in turn, at the rate given by its assertions and for the duration of the task,
+// and checks their responses against the assertions.
+func (t *CollectTask) checkAssertions(entry *logrus.Entry, j int, requests []fortioRequest) (*assertionResult, error) {
+	dur, err := time.ParseDuration(*t.With.Time)
+	if err != nil {
+		return nil, err
+	}
+	assertions, err := t.With.Versions[j].Assertions.compile()
+	if err != nil {
+		return nil, err
+	}
+	client, err := t.httpClient(j)
+	if err != nil {
+		return nil, err
+	}
+	qps := DefaultAssertionQPS
+	if assertions.QPS != nil {
+		qps = *assertions.QPS
+	}
+	interval := time.Duration(float64(time.Second) / float64(qps))
+
+	res := &assertionResult{}
+	end := time.Now().Add(dur)
+	for k, next := 0, time.Now(); next.Before(end); k, next = k+1, next.Add(interval) {
+		time.Sleep(time.Until(next))
+		checked, checkErr := t.checkResponse(entry, client, assertions, &requests[k%len(requests)])
+		if !checked {
+			if checkErr != nil {
+				return nil, checkErr
+			}
+			continue
+		}
+		res.checks++
+		if checkErr != nil {
+			entry.Debug("assertion failed: ", checkErr)
+			res.errors++
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestCheckAssertions(t *testing.T) {
+	var n int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "example.com", r.Host)
+		// every other response is a semantic error
+		if atomic.AddInt32(&n, 1)%2 == 0 {
+			fmt.Fprint(w, `{"status": "error"}`)
+		} else {
+			fmt.Fprint(w, `{"status": "ok"}`)
+		}
+	}))
+	defer server.Close()
+
+	ct := CollectTask{
+		With: CollectInputs{
+			Time: tasks.StringPointer("1s"),
+			Versions: []Version{{
+				Name:   "default",
+				URL:    server.URL,
+				Method: tasks.StringPointer(http.MethodGet),
+				Host:   tasks.StringPointer("example.com"),
+				Assertions: &Assertions{
+					QPS:            tasks.Float32Pointer(20),
+					JSONPathEquals: []JSONPathAssertion{{Path: ".status", Value: "ok"}},
+				},
+			}},
+		},
+	}
+	ct.InitializeDefaults()
+	assert.NoError(t, ct.validate())
+
+	requests, err := ct.requestsForVersion(0, "", nil)
+	assert.NoError(t, err)
+	res, err := ct.checkAssertions(log.WithField("version", "default"), 0, requests)
+	assert.NoError(t, err)
+	assert.Equal(t, int(atomic.LoadInt32(&n)), res.checks)
+	assert.InDelta(t, 20, res.checks, 4)
+	assert.Equal(t, res.checks/2, res.errors)
+
+}
+
+func TestAssertionMethods(t *testing.T) {
+	ct := CollectTask{
+		With: CollectInputs{
+			Versions: []Version{{
+				Name:       "default",
+				URL:        "https://example.com",
+				Assertions: &Assertions{BodyContains: tasks.StringPointer("ok")},
+			}},
+		},
+	}
+	ct.InitializeDefaults()
+	assert.NoError(t, ct.validate())
+
+	// checking assertions repeats the requests of the version, which must therefore be safe
+	ct.With.Versions[0].Method = tasks.StringPointer(http.MethodHead)
+	assert.NoError(t, ct.validate())
+	ct.With.Versions[0].Method = tasks.StringPointer(http.MethodPut)
+	assert.Error(t, ct.validate())
+	ct.With.Versions[0].Method = nil
+	ct.With.Versions[0].Requests = []Request{{}, {Payload: tasks.StringPointer("abc")}}
+	assert.Error(t, ct.validate())
+	ct.With.Versions[0].Requests[1].Method = tasks.StringPointer(http.MethodGet)
+	assert.NoError(t, ct.validate())
+	ct.With.Versions[0].Requests = nil
+	ct.With.ContentType = tasks.StringPointer("application/json")
+	assert.Error(t, ct.validate())
+}
+
+func TestAssertionMetrics(t *testing.T) {
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../../../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	bytes, err := json.Marshal(map[string]*Result{
+		"default": {AssertionChecks: 20, AssertionErrors: 5},
+		"other":   {},
+	})
+	assert.NoError(t, err)
+	exp.SetAggregatedBuiltinHists(v1.JSON{Raw: bytes})
+
+	// etc3 replaces the analysis of the experiment in each iteration, and keeps only the aggregated builtin hists
+	exp.Status.Analysis = &v2alpha2.Analysis{
+		AggregatedBuiltinHists: exp.Status.Analysis.AggregatedBuiltinHists,
+	}
+
+	metrics, err := AssertionMetrics(exp)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(5), metrics[AssertionErrorCountMetric]["default"])
+	assert.Equal(t, 0.25, metrics[AssertionErrorRateMetric]["default"])
+	assert.NotContains(t, metrics[AssertionErrorCountMetric], "other")
+}
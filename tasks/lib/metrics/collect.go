@@ -16,12 +16,14 @@ import (
 	"math"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/iter8-tools/etc3/api/v2alpha2"
 	"github.com/iter8-tools/handler/tasks"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 )
 
@@ -34,8 +36,65 @@ const (
 
 	// DefaultTime is the default value of time (duration of queries) in collect task inputs
 	DefaultTime string = "5s"
+
+	// DefaultRequestWeight is the default weight of a request in a request set
+	DefaultRequestWeight int32 = 1
+
+	// AssertionErrorCountMetric is the built-in metric for the number of checked responses of a version that failed its assertions
+	AssertionErrorCountMetric string = "builtin-metrics/assertion-error-count"
+
+	// AssertionErrorRateMetric is the built-in metric for the fraction of checked responses of a version that failed its assertions
+	AssertionErrorRateMetric string = "builtin-metrics/assertion-error-rate"
+)
+
+// SamplingType identifies how the QPS of a version is shared among the requests in its request set.
+// Every request is sent by its own Fortio process, in parallel, at a fixed share of the QPS;
+// requests are neither interleaved in turn (round-robin) nor chosen at random, which are not supported.
+type SamplingType string
+
+const (
+	// EqualSampling gives every request in the request set an equal share of the QPS of the version
+	EqualSampling SamplingType = "equal"
+
+	// WeightedSampling gives every request in the request set a share of the QPS of the version
+	// that is proportional to its weight
+	WeightedSampling SamplingType = "weighted"
 )
 
+// ConfigMapRef refers to a key within a config map
+type ConfigMapRef struct {
+	// name of the config map in the form namespace/name or name;
+	// if the namespace is omitted, the namespace of the experiment is used
+	Name string `json:"name" yaml:"name"`
+	// key within the config map whose value is used
+	Key string `json:"key" yaml:"key"`
+}
+
+// Request is one of the requests in the request set of a version.
+// The URL and headers of the request are derived from those of the version.
+type Request struct {
+	// HTTP method of this request; optional; default is GET, or POST if a payload is present
+	Method *string `json:"method,omitempty" yaml:"method,omitempty"`
+	// path appended to the URL of the version; optional
+	Path *string `json:"path,omitempty" yaml:"path,omitempty"`
+	// HTTP headers for this request; these are added to the headers of the version; optional
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// payload sent with this request; optional
+	Payload *string `json:"payload,omitempty" yaml:"payload,omitempty"`
+	// relative weight of this request; used with weighted sampling; optional; default 1
+	Weight *int32 `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// TLS contains the TLS options used to query a version
+type TLS struct {
+	// secret containing the CA bundle used to verify the certificate of the version under the key ca.crt; optional
+	CASecret *string `json:"caSecret,omitempty" yaml:"caSecret,omitempty"`
+	// secret containing the client certificate and key used for mutual TLS under the keys tls.crt and tls.key; optional
+	CertSecret *string `json:"certSecret,omitempty" yaml:"certSecret,omitempty"`
+	// if true, the certificate of the version is not verified; optional; default false
+	InsecureSkipVerify *bool `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"`
+}
+
 // Version contains header and url information needed to send requests to each version.
 type Version struct {
 	// name of the version
@@ -48,6 +107,23 @@ type Version struct {
 	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
 	// URL to use for querying this version
 	URL string `json:"url" yaml:"url"`
+	// set of requests used to query this version; optional
+	// if specified, the QPS of this version is shared among these requests
+	Requests []Request `json:"requests,omitempty" yaml:"requests,omitempty"`
+	// how the QPS of this version is shared among the requests in the request set: equal or weighted (by weight); random sampling is not supported; optional; default equal
+	Sampling *SamplingType `json:"sampling,omitempty" yaml:"sampling,omitempty"`
+	// HTTP method to use in the query for this version; optional; default is GET, or POST if a payload is present
+	Method *string `json:"method,omitempty" yaml:"method,omitempty"`
+	// timeout of each request sent to this version, such as 500ms or 2s; optional
+	Timeout *string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// TLS options used to query this version; optional
+	TLS *TLS `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// if true, HTTP/2 is used to query this version; optional; default false
+	HTTP2 *bool `json:"http2,omitempty" yaml:"http2,omitempty"`
+	// value of the Host header used in the query for this version; optional
+	Host *string `json:"host,omitempty" yaml:"host,omitempty"`
+	// checks on the responses of this version; responses that fail them are counted as assertion errors; optional
+	Assertions *Assertions `json:"assertions,omitempty" yaml:"assertions,omitempty"`
 }
 
 // CollectInputs contain the inputs to the metrics collection task to be executed.
@@ -58,15 +134,24 @@ type CollectInputs struct {
 	Versions []Version `json:"versions" yaml:"versions"`
 	// URL of the JSON file to send during the query; optional
 	PayloadURL *string `json:"payloadURL,omitempty" yaml:"payloadURL,omitempty"`
+	// payload to send during the query; interpolated using the variables of each version; optional
+	Payload *string `json:"payload,omitempty" yaml:"payload,omitempty"`
+	// config map key whose value is sent as the payload during the query; optional
+	PayloadConfigMap *ConfigMapRef `json:"payloadConfigMap,omitempty" yaml:"payloadConfigMap,omitempty"`
+	// content type of the payload; optional
+	ContentType *string `json:"contentType,omitempty" yaml:"contentType,omitempty"`
 	// if LoadOnly is set to true, this task will send requests without collecting metrics; optional
 	LoadOnly *bool `json:"loadOnly,omitempty" yaml:"loadOnly,omitempty"`
+	// where the raw results of each run of this task are exported; optional
+	Export *Export `json:"export,omitempty" yaml:"export,omitempty"`
+	// Prometheus Pushgateway to which built-in metrics aggregated across runs are pushed; optional
+	Pushgateway *Pushgateway `json:"pushgateway,omitempty" yaml:"pushgateway,omitempty"`
 }
 
 // CollectTask enables collection of Iter8's built-in metrics.
 type CollectTask struct {
-	Library string        `json:"library" yaml:"library"`
-	Task    string        `json:"task" yaml:"task"`
-	With    CollectInputs `json:"with" yaml:"with"`
+	tasks.TaskMeta `json:",inline" yaml:",inline"`
+	With           CollectInputs `json:"with" yaml:"with"`
 }
 
 // MakeCollect constructs a CollectTask out of a collect task spec
@@ -86,6 +171,9 @@ func MakeCollect(t *v2alpha2.TaskSpec) (tasks.Task, error) {
 		if ct.With.Versions == nil {
 			return nil, errors.New("Collect task with nil versions")
 		}
+		if err = ct.validate(); err != nil {
+			return nil, err
+		}
 		bt = ct
 	}
 	return bt, err
@@ -101,9 +189,71 @@ func (t *CollectTask) InitializeDefaults() {
 		if t.With.Versions[i].QPS == nil {
 			t.With.Versions[i].QPS = tasks.Float32Pointer(DefaultQPS)
 		}
+		if t.With.Versions[i].Sampling == nil {
+			sampling := EqualSampling
+			t.With.Versions[i].Sampling = &sampling
+		}
+		for k := 0; k < len(t.With.Versions[i].Requests); k++ {
+			if t.With.Versions[i].Requests[k].Weight == nil {
+				t.With.Versions[i].Requests[k].Weight = tasks.Int32Pointer(DefaultRequestWeight)
+			}
+		}
 	}
 }
 
+// validate checks the payload and request set inputs of the task
+func (t *CollectTask) validate() error {
+	numPayloads := 0
+	for _, p := range []bool{t.With.PayloadURL != nil, t.With.Payload != nil, t.With.PayloadConfigMap != nil} {
+		if p {
+			numPayloads++
+		}
+	}
+	if numPayloads > 1 {
+		return errors.New("at most one of payloadURL, payload and payloadConfigMap may be specified")
+	}
+	if t.With.Export != nil {
+		if err := t.With.Export.validate(); err != nil {
+			return err
+		}
+	}
+	if t.With.Pushgateway != nil {
+		if t.With.Pushgateway.URL == "" {
+			return errors.New("pushgateway requires a url")
+		}
+		if t.With.LoadOnly != nil && *t.With.LoadOnly {
+			return errors.New("pushgateway cannot be used with loadOnly")
+		}
+	}
+	for _, v := range t.With.Versions {
+		if v.Sampling != nil && *v.Sampling != EqualSampling && *v.Sampling != WeightedSampling {
+			return fmt.Errorf("unknown sampling type %s for version %s", *v.Sampling, v.Name)
+		}
+		for _, r := range v.Requests {
+			if r.Weight != nil && *r.Weight <= 0 {
+				return fmt.Errorf("request weights must be positive for version %s", v.Name)
+			}
+		}
+		if v.Timeout != nil {
+			if _, err := time.ParseDuration(*v.Timeout); err != nil {
+				return fmt.Errorf("invalid timeout %s for version %s", *v.Timeout, v.Name)
+			}
+		}
+		if v.Assertions != nil {
+			if err := t.validateAssertionMethods(&v); err != nil {
+				return err
+			}
+			if v.Assertions.QPS != nil && *v.Assertions.QPS <= 0 {
+				return fmt.Errorf("assertions qps must be positive for version %s", v.Name)
+			}
+			if _, err := v.Assertions.compile(); err != nil {
+				return fmt.Errorf("invalid assertions for version %s: %s", v.Name, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
 ////
 /////////////
 ////
@@ -123,10 +273,29 @@ type DurationHist struct {
 	Data  []DurationSample
 }
 
+// RequestOptions are the options used to query a version; these are recorded along with the result
+type RequestOptions struct {
+	Method             string `json:",omitempty"`
+	Timeout            string `json:",omitempty"`
+	Host               string `json:",omitempty"`
+	HTTP2              bool   `json:",omitempty"`
+	TLS                bool   `json:",omitempty"`
+	MutualTLS          bool   `json:",omitempty"`
+	InsecureSkipVerify bool   `json:",omitempty"`
+}
+
 // Result is the result of a single Fortio run; it contains the result for a single version
 type Result struct {
 	DurationHistogram DurationHist
 	RetCodes          map[string]int
+	RequestOptions    *RequestOptions `json:",omitempty"`
+	// number of responses that were checked against the assertions of the version;
+	// these responses are to requests sent in addition to those of Fortio
+	AssertionChecks int `json:",omitempty"`
+	// number of checked responses that failed the assertions of the version
+	AssertionErrors int `json:",omitempty"`
+	// most recent values of metrics of the version queried from a metrics backend by the metrics/query task, keyed by metric
+	QueriedMetrics map[string]float64 `json:",omitempty"`
 }
 
 // aggregate existing results, with a new result for a specific version
@@ -147,6 +316,15 @@ func aggregate(oldResults map[string]*Result, version string, newResult *Result)
 		// aggregation duration histogram data
 		updatedResult.DurationHistogram.Data = append(updatedResult.DurationHistogram.Data, newResult.DurationHistogram.Data...)
 
+		// aggregate assertion checks and errors
+		updatedResult.AssertionChecks += newResult.AssertionChecks
+		updatedResult.AssertionErrors += newResult.AssertionErrors
+
+		// request options of the most recent result are retained
+		if newResult.RequestOptions != nil {
+			updatedResult.RequestOptions = newResult.RequestOptions
+		}
+
 		// aggregate return code counts
 		if updatedResult.RetCodes == nil {
 			updatedResult.RetCodes = newResult.RetCodes
@@ -226,8 +404,322 @@ func payloadFile(url string) (string, error) {
 	return tmpfile.Name(), nil
 }
 
+// payloadFileFromConfigMap writes the value of a config map key into a temp file, and returns its name
+func payloadFileFromConfigMap(ref *ConfigMapRef) (string, error) {
+	cm, err := tasks.GetConfigMap(ref.Name)
+	if err != nil {
+		log.Error("Error while getting config map: ", err)
+		return "", err
+	}
+
+	var content []byte
+	if data, ok := cm.Data[ref.Key]; ok {
+		content = []byte(data)
+	} else if data, ok := cm.BinaryData[ref.Key]; ok {
+		content = data
+	} else {
+		return "", fmt.Errorf("key %s not found in config map %s", ref.Key, ref.Name)
+	}
+
+	tmpfile, err := ioutil.TempFile("/tmp", "payload")
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	if _, err := tmpfile.Write(content); err != nil {
+		tmpfile.Close()
+		log.Error(err)
+		return "", err
+	}
+	if err := tmpfile.Close(); err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	return tmpfile.Name(), nil
+}
+
+// fortioRequest is a single request configuration used to query a version
+type fortioRequest struct {
+	url         string
+	method      *string
+	headers     map[string]string
+	payload     *string
+	payloadFile string
+	qps         float32
+	// args holds the Fortio flags for the TLS, HTTP/2 and timeout options of the version
+	args []string
+}
+
+// tlsData retrieves the CA bundle, and the client certificate and key, of a version from their secrets;
+// the returned map is keyed by ca.crt, tls.crt and tls.key respectively
+func tlsData(v *Version) (map[string][]byte, error) {
+	if v.TLS == nil {
+		return map[string][]byte{}, nil
+	}
+	return tasks.TLSData(v.TLS.CASecret, v.TLS.CertSecret)
+}
+
+// tlsFile writes TLS data into a temp file, and returns its name
+func tlsFile(key string, content []byte) (string, error) {
+	tmpfile, err := ioutil.TempFile("/tmp", key)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	if _, err := tmpfile.Write(content); err != nil {
+		tmpfile.Close()
+		log.Error(err)
+		return "", err
+	}
+	if err := tmpfile.Close(); err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	return tmpfile.Name(), nil
+}
+
+// requestOptions summarizes the options used to query a given version
+func (t *CollectTask) requestOptions(j int) *RequestOptions {
+	v := t.With.Versions[j]
+	options := &RequestOptions{}
+	if v.Method != nil {
+		options.Method = *v.Method
+	}
+	if v.Host != nil {
+		options.Host = *v.Host
+	}
+	if v.Timeout != nil {
+		options.Timeout = *v.Timeout
+	}
+	options.HTTP2 = v.HTTP2 != nil && *v.HTTP2
+	if v.TLS != nil {
+		options.TLS = true
+		options.MutualTLS = v.TLS.CertSecret != nil
+		options.InsecureSkipVerify = v.TLS.InsecureSkipVerify != nil && *v.TLS.InsecureSkipVerify
+	}
+	return options
+}
+
+// optionsForVersion constructs the Fortio flags for the request options of a given version,
+// and returns them along with the names of any files created for them; the caller is responsible
+// for removing these files
+func (t *CollectTask) optionsForVersion(j int) (*RequestOptions, []string, []string, error) {
+	v := t.With.Versions[j]
+	options := t.requestOptions(j)
+	args := []string{}
+	files := []string{}
+
+	if options.Timeout != "" {
+		args = append(args, "-timeout", options.Timeout)
+	}
+	if options.HTTP2 {
+		args = append(args, "-h2")
+	}
+	if options.InsecureSkipVerify {
+		args = append(args, "-k")
+	}
+
+	data, err := tlsData(&v)
+	if err != nil {
+		return nil, nil, files, err
+	}
+	flags := []struct {
+		flag string
+		key  string
+	}{
+		{"-cacert", corev1.ServiceAccountRootCAKey},
+		{"-cert", corev1.TLSCertKey},
+		{"-key", corev1.TLSPrivateKeyKey},
+	}
+	for _, f := range flags {
+		if content, ok := data[f.key]; ok {
+			name, err := tlsFile(f.key, content)
+			if err != nil {
+				return nil, nil, files, err
+			}
+			files = append(files, name)
+			args = append(args, f.flag, name)
+		}
+	}
+	return options, args, files, nil
+}
+
+// requestsForVersion constructs the requests for a given version; tags are used to interpolate
+// the URLs, headers and payloads of the requests
+func (t *CollectTask) requestsForVersion(j int, pf string, tags *tasks.Tags) ([]fortioRequest, error) {
+	v := t.With.Versions[j]
+
+	url, err := tags.Interpolate(&v.URL)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string, len(v.Headers))
+	for header, value := range v.Headers {
+		if headers[header], err = tags.Interpolate(&value); err != nil {
+			return nil, err
+		}
+	}
+
+	if v.Host != nil {
+		headers["Host"] = *v.Host
+	}
+
+	base := fortioRequest{
+		url:         url,
+		method:      v.Method,
+		headers:     headers,
+		payloadFile: pf,
+		qps:         *v.QPS,
+	}
+	if t.With.Payload != nil {
+		payload, err := tags.Interpolate(t.With.Payload)
+		if err != nil {
+			return nil, err
+		}
+		base.payload = &payload
+	}
+
+	// no request set; this version is queried using a single request
+	if len(v.Requests) == 0 {
+		return []fortioRequest{base}, nil
+	}
+
+	// the QPS of this version is shared among the requests of the request set
+	totalWeight := int32(0)
+	for _, r := range v.Requests {
+		totalWeight += *r.Weight
+	}
+	requests := make([]fortioRequest, len(v.Requests))
+	for k, r := range v.Requests {
+		req := base
+		if r.Method != nil {
+			req.method = r.Method
+		}
+		if r.Path != nil {
+			path, err := tags.Interpolate(r.Path)
+			if err != nil {
+				return nil, err
+			}
+			req.url = strings.TrimSuffix(base.url, "/") + "/" + strings.TrimPrefix(path, "/")
+		}
+		req.headers = make(map[string]string, len(base.headers)+len(r.Headers))
+		for header, value := range base.headers {
+			req.headers[header] = value
+		}
+		for header, value := range r.Headers {
+			if req.headers[header], err = tags.Interpolate(&value); err != nil {
+				return nil, err
+			}
+		}
+		if r.Payload != nil {
+			payload, err := tags.Interpolate(r.Payload)
+			if err != nil {
+				return nil, err
+			}
+			req.payload = &payload
+			req.payloadFile = ""
+		}
+		if *v.Sampling == WeightedSampling {
+			req.qps = base.qps * float32(*r.Weight) / float32(totalWeight)
+		} else {
+			req.qps = base.qps / float32(len(v.Requests))
+		}
+		requests[k] = req
+	}
+	return requests, nil
+}
+
 // resultForVersion collects Fortio result for a given version
-func (t *CollectTask) resultForVersion(entry *logrus.Entry, j int, pf string) (*Result, error) {
+func (t *CollectTask) resultForVersion(entry *logrus.Entry, j int, pf string, tags *tasks.Tags) (*Result, error) {
+	options, args, files, err := t.optionsForVersion(j)
+	// clean up files created for TLS options
+	defer func() {
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}()
+	if err != nil {
+		entry.Error(err)
+		return nil, err
+	}
+
+	requests, err := t.requestsForVersion(j, pf, tags)
+	if err != nil {
+		entry.Error(err)
+		return nil, err
+	}
+	for k := range requests {
+		requests[k].args = args
+	}
+
+	// responses are checked against the assertions of the version, if any, while Fortio sends requests
+	var checks *assertionResult
+	checkErr := make(chan error, 1)
+	if t.With.Versions[j].Assertions != nil {
+		go func() {
+			var err error
+			checks, err = t.checkAssertions(entry, j, requests)
+			checkErr <- err
+		}()
+	} else {
+		checkErr <- nil
+	}
+
+	res, err := t.fortioResultForVersion(entry, j, requests)
+	if cerr := <-checkErr; err == nil && cerr != nil {
+		entry.Error(cerr)
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if checks != nil {
+		res.AssertionChecks = checks.checks
+		res.AssertionErrors = checks.errors
+	}
+	res.RequestOptions = options
+	return res, nil
+}
+
+// fortioResultForVersion collects Fortio results for the requests of a given version, and aggregates them
+func (t *CollectTask) fortioResultForVersion(entry *logrus.Entry, j int, requests []fortioRequest) (*Result, error) {
+	// a single request needs no further coordination
+	if len(requests) == 1 {
+		return t.resultForRequest(entry, &requests[0])
+	}
+
+	// requests in the request set are sent in parallel; their results are aggregated
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var results map[string]*Result
+	errs := make([]error, len(requests))
+	for k := range requests {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			res, err := t.resultForRequest(entry.WithField("request", k), &requests[k])
+			if err != nil {
+				errs[k] = err
+				return
+			}
+			lock.Lock()
+			results = aggregate(results, t.With.Versions[j].Name, res)
+			lock.Unlock()
+		}(k)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results[t.With.Versions[j].Name], nil
+}
+
+// resultForRequest collects Fortio result for a single request configuration
+func (t *CollectTask) resultForRequest(entry *logrus.Entry, req *fortioRequest) (*Result, error) {
 	// the main idea is to run Fortio shell command with proper args
 	// collect Fortio output as a file
 	// and extract the result from the file, and return the result
@@ -238,14 +730,26 @@ func (t *CollectTask) resultForVersion(entry *logrus.Entry, j int, pf string) (*
 	// append Fortio time flag
 	args = append(args, "-t", *t.With.Time)
 	// append Fortio qps flag
-	args = append(args, "-qps", fmt.Sprintf("%f", *t.With.Versions[j].QPS))
+	args = append(args, "-qps", fmt.Sprintf("%f", req.qps))
+	// append Fortio method flag
+	if req.method != nil {
+		args = append(args, "-X", *req.method)
+	}
+	// append Fortio flags for TLS, HTTP/2 and timeout options
+	args = append(args, req.args...)
 	// append Fortio header flags
-	for header, value := range t.With.Versions[j].Headers {
+	for header, value := range req.headers {
 		args = append(args, "-H", fmt.Sprintf("%v: %v", header, value))
 	}
-	// download JSON payload if specified; and append Fortio ayload-file flag
-	if t.With.PayloadURL != nil {
-		args = append(args, "-payload-file", pf)
+	// append Fortio content type flag
+	if t.With.ContentType != nil {
+		args = append(args, "-content-type", *t.With.ContentType)
+	}
+	// append Fortio payload or payload-file flag
+	if req.payload != nil {
+		args = append(args, "-payload", *req.payload)
+	} else if req.payloadFile != "" {
+		args = append(args, "-payload-file", req.payloadFile)
 	}
 
 	// create json output file; and Fortio append json flag
@@ -258,7 +762,7 @@ func (t *CollectTask) resultForVersion(entry *logrus.Entry, j int, pf string) (*
 	jsonOutputFile.Close()
 
 	// append URL to be queried by Fortio
-	args = append(args, t.With.Versions[j].URL)
+	args = append(args, req.url)
 
 	// setup Fortio command
 	cmd := exec.Command("fortio", args...)
@@ -267,7 +771,7 @@ func (t *CollectTask) resultForVersion(entry *logrus.Entry, j int, pf string) (*
 	entry.Trace("Invoking: " + cmd.String())
 
 	// execute Fortio command
-	err = cmd.Run()
+	err = tasks.RunCommand(entry.Context, cmd)
 	if err != nil {
 		entry.Fatal(err)
 		return nil, err
@@ -283,6 +787,40 @@ func (t *CollectTask) resultForVersion(entry *logrus.Entry, j int, pf string) (*
 	return ifr, err
 }
 
+// builtinResults returns the results of each version recorded in the aggregated builtin hists of the experiment, if any
+func builtinResults(e *tasks.Experiment) (map[string]*Result, error) {
+	results := make(map[string]*Result)
+	if e.Status.Analysis == nil || e.Status.Analysis.AggregatedBuiltinHists == nil || len(e.Status.Analysis.AggregatedBuiltinHists.Data.Raw) == 0 {
+		return results, nil
+	}
+	if err := json.Unmarshal(e.Status.Analysis.AggregatedBuiltinHists.Data.Raw, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// AssertionMetrics returns the values of the built-in assertion metrics of each version whose responses were checked against assertions,
+// keyed by metric and version. They are derived from the assertion checks and errors recorded with the result of each version
+// in the aggregated builtin hists, which etc3 keeps when it updates the analysis of the experiment.
+func AssertionMetrics(e *tasks.Experiment) (map[string]map[string]float64, error) {
+	metrics := map[string]map[string]float64{
+		AssertionErrorCountMetric: {},
+		AssertionErrorRateMetric:  {},
+	}
+	results, err := builtinResults(e)
+	if err != nil {
+		return nil, err
+	}
+	for version, res := range results {
+		if res.AssertionChecks == 0 {
+			continue
+		}
+		metrics[AssertionErrorCountMetric][version] = float64(res.AssertionErrors)
+		metrics[AssertionErrorRateMetric][version] = float64(res.AssertionErrors) / float64(res.AssertionChecks)
+	}
+	return metrics, nil
+}
+
 // Run executes the metrics/collect task
 // Todo: error handling
 func (t *CollectTask) Run(ctx context.Context) error {
@@ -314,15 +852,18 @@ func (t *CollectTask) Run(ctx context.Context) error {
 		}
 	}
 
-	// lock ensures thread safety while updating fortioData from go routines
+	// results of this run alone; these are exported if needed
+	runResults := make(map[string]*Result)
+
+	// lock ensures thread safety while updating fortioData and runResults from go routines
 	var lock sync.Mutex
 
 	// if errors occur in one of the parallel go routines, errCh is used to communicate them
 	errCh := make(chan error)
 	defer close(errCh)
 
-	// download JSON from URL if specified
-	// this is intended to be used as a JSON payload file by Fortio
+	// download JSON from URL, or read config map key, if specified
+	// this is intended to be used as a payload file by Fortio
 	tmpfileName := ""
 	if t.With.PayloadURL != nil {
 		var err error
@@ -330,6 +871,12 @@ func (t *CollectTask) Run(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
+	} else if t.With.PayloadConfigMap != nil {
+		var err error
+		tmpfileName, err = payloadFileFromConfigMap(t.With.PayloadConfigMap)
+		if err != nil {
+			return err
+		}
 	}
 	defer os.Remove(tmpfileName) // clean up later
 
@@ -338,14 +885,27 @@ func (t *CollectTask) Run(ctx context.Context) error {
 		// Increment the WaitGroup counter.
 		wg.Add(1)
 		// get log entry
-		entry := log.WithField("version", t.With.Versions[j].Name)
+		entry := log.WithField(tasks.VersionLogField, t.With.Versions[j].Name)
 		// Launch a goroutine to fetch the Fortio data for this version.
 		go func(entry *logrus.Entry, k int) {
 			// Decrement the counter when the goroutine completes.
 			defer wg.Done()
+			// trace load generation for this version; fortio subprocesses are traced within its span
+			vctx, span := tasks.StartSpan(ctx, "collect "+t.With.Versions[k].Name, tasks.VersionAttribute.String(t.With.Versions[k].Name))
+			entry = entry.WithContext(vctx)
 			// Get Fortio data for version
-			data, err := t.resultForVersion(entry, k, tmpfileName)
+			tags := tasks.ExperimentTags(ctx, exp).
+				WithVersion(&exp.Experiment, t.With.Versions[k].Name)
+			data, err := t.resultForVersion(entry, k, tmpfileName, &tags)
+			tasks.EndSpan(span, err)
 			if err == nil {
+				if t.With.Export != nil {
+					// copy the result since it may be aggregated with earlier results below
+					result := *data
+					lock.Lock()
+					runResults[t.With.Versions[k].Name] = &result
+					lock.Unlock()
+				}
 				// if this task is **not** loadOnly
 				if t.With.LoadOnly == nil || *t.With.LoadOnly == false {
 					// Update fortioData in a threadsafe manner
@@ -390,16 +950,48 @@ func (t *CollectTask) Run(ctx context.Context) error {
 			return err
 		}
 
-		exp.SetAggregatedBuiltinHists(v1.JSON{Raw: bytes1})
+		// failure to push metrics does not fail the task; the pushed metrics are only used for observability
+		if t.With.Pushgateway != nil {
+			if perr := t.With.Pushgateway.push(ctx, exp, fortioData); perr != nil {
+				log.Error("Unable to push metrics: ", perr)
+			}
+		}
 
-		err = tasks.UpdateInClusterExperimentStatus(exp)
+		// only the aggregated builtin hists are written, since etc3 may have changed other fields of the status during the run;
+		// they include the assertion checks and errors of each version, from which the built-in assertion metrics are derived
+		if err = tasks.UpdateInClusterExperimentStatus(exp, func(e *tasks.Experiment) error {
+			e.SetAggregatedBuiltinHists(v1.JSON{Raw: bytes1})
+			return nil
+		}); err != nil {
+			log.Error("Unable to update experiment status: ", err)
+			return err
+		}
 
 		var prettyBody bytes.Buffer
-		bytes2, err := json.Marshal(exp)
+		bytes2, _ := json.Marshal(exp)
 
 		json.Indent(&prettyBody, bytes2, "", "  ")
 		log.Trace(string(prettyBody.Bytes()))
 	}
 
-	return err
+	// export raw results of this run, and record where they were exported in the experiment
+	// failure to export results does not fail the task, as with pushing metrics; the status has already been updated
+	if t.With.Export != nil {
+		if refs, eerr := t.With.Export.export(exp, runResults); eerr != nil {
+			log.Error("Unable to export results: ", eerr)
+		} else {
+			log.Info("Exported results: ", refs)
+			if eerr = tasks.UpdateInClusterExperiment(exp, func(e *tasks.Experiment) error {
+				if e.Annotations == nil {
+					e.Annotations = make(map[string]string)
+				}
+				e.Annotations[ResultsAnnotation] = strings.Join(refs, ",")
+				return nil
+			}); eerr != nil {
+				log.Error("Unable to record exported results: ", eerr)
+			}
+		}
+	}
+
+	return nil
 }
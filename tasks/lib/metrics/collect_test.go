@@ -1,16 +1,21 @@
 package metrics
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/iter8-tools/handler/tasks"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestInitializeDefaults(t *testing.T) {
 	ct := CollectTask{
-		Library: "metrics",
-		Task:    "collect",
+		TaskMeta: tasks.TaskMeta{Library: "metrics", Task: "collect"},
 		With: CollectInputs{
 			Versions: []Version{{
 				Name: "default",
@@ -109,8 +114,7 @@ func TestPayloadFile(t *testing.T) {
 
 func TestResultForVersion(t *testing.T) {
 	ct := CollectTask{
-		Library: "metrics",
-		Task:    "collect",
+		TaskMeta: tasks.TaskMeta{Library: "metrics", Task: "collect"},
 		With: CollectInputs{
 			Versions: []Version{{
 				Name: "default",
@@ -120,7 +124,213 @@ func TestResultForVersion(t *testing.T) {
 	}
 	ct.InitializeDefaults()
 	entry := log.WithField("version", "default")
-	res, err := ct.resultForVersion(entry, 0, "")
+	res, err := ct.resultForVersion(entry, 0, "", nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
 }
+
+func TestRequestsForVersion(t *testing.T) {
+	weighted := WeightedSampling
+	ct := CollectTask{
+		TaskMeta: tasks.TaskMeta{Library: "metrics", Task: "collect"},
+		With: CollectInputs{
+			Payload: tasks.StringPointer(`{"revision": "{{ .revision }}"}`),
+			Versions: []Version{{
+				Name:    "default",
+				URL:     "http://{{ .revision }}.default/",
+				Headers: map[string]string{"x-version": "{{ .name }}"},
+			}, {
+				Name: "canary",
+				URL:  "http://{{ .revision }}.default",
+				QPS:  tasks.Float32Pointer(12),
+				Requests: []Request{{
+					Path:    tasks.StringPointer("/predict"),
+					Method:  tasks.StringPointer("PUT"),
+					Payload: tasks.StringPointer("{{ .name }}"),
+					Weight:  tasks.Int32Pointer(2),
+				}, {
+					Path:    tasks.StringPointer("health"),
+					Headers: map[string]string{"x-probe": "true"},
+				}},
+				Sampling: &weighted,
+			}},
+		},
+	}
+	ct.InitializeDefaults()
+	assert.NoError(t, ct.validate())
+
+	tags := tasks.NewTags().With("name", "default").With("revision", "revision1")
+	requests, err := ct.requestsForVersion(0, "", &tags)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(requests))
+	assert.Equal(t, "http://revision1.default/", requests[0].url)
+	assert.Equal(t, "default", requests[0].headers["x-version"])
+	assert.Equal(t, `{"revision": "revision1"}`, *requests[0].payload)
+	assert.Equal(t, DefaultQPS, requests[0].qps)
+
+	tags = tasks.NewTags().With("name", "canary").With("revision", "revision2")
+	requests, err = ct.requestsForVersion(1, "", &tags)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(requests))
+	assert.Equal(t, "http://revision2.default/predict", requests[0].url)
+	assert.Equal(t, "PUT", *requests[0].method)
+	assert.Equal(t, "canary", *requests[0].payload)
+	assert.Equal(t, float32(8), requests[0].qps)
+	assert.Equal(t, "http://revision2.default/health", requests[1].url)
+	assert.Nil(t, requests[1].method)
+	assert.Equal(t, "true", requests[1].headers["x-probe"])
+	assert.Equal(t, float32(4), requests[1].qps)
+
+	// round robin sampling shares QPS equally
+	equal := EqualSampling
+	ct.With.Versions[1].Sampling = &equal
+	requests, err = ct.requestsForVersion(1, "", &tags)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(6), requests[0].qps)
+	assert.Equal(t, float32(6), requests[1].qps)
+}
+
+func TestValidate(t *testing.T) {
+	ct := CollectTask{
+		With: CollectInputs{
+			PayloadURL: tasks.StringPointer("https://iter8.tools"),
+			Payload:    tasks.StringPointer("payload"),
+			Versions:   []Version{{Name: "default", URL: "https://iter8.tools"}},
+		},
+	}
+	assert.Error(t, ct.validate())
+
+	ct.With.PayloadURL = nil
+	assert.NoError(t, ct.validate())
+
+	unknown := SamplingType("unknown")
+	ct.With.Versions[0].Sampling = &unknown
+	assert.Error(t, ct.validate())
+
+	ct.With.Versions[0].Sampling = nil
+	ct.With.Versions[0].Requests = []Request{{Weight: tasks.Int32Pointer(0)}}
+	assert.Error(t, ct.validate())
+
+	ct.With.Versions[0].Requests = nil
+	ct.With.Pushgateway = &Pushgateway{URL: "http://pushgateway:9091"}
+	assert.NoError(t, ct.validate())
+
+	ct.With.LoadOnly = tasks.BoolPointer(true)
+	assert.Error(t, ct.validate())
+}
+
+func TestPayloadFileFromConfigMap(t *testing.T) {
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "payload",
+				Namespace: "default",
+			},
+			Data: map[string]string{
+				"request.json": `{"hello": "world"}`,
+			},
+		}).Build(), nil
+	}
+
+	fileName, err := payloadFileFromConfigMap(&ConfigMapRef{Name: "default/payload", Key: "request.json"})
+	assert.NoError(t, err)
+	defer os.Remove(fileName)
+	content, err := ioutil.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hello": "world"}`, string(content))
+
+	_, err = payloadFileFromConfigMap(&ConfigMapRef{Name: "default/payload", Key: "other.json"})
+	assert.Error(t, err)
+}
+
+func TestOptionsForVersion(t *testing.T) {
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ca",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"ca.crt": []byte("ca"),
+			},
+		}, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "client",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"tls.crt": []byte("cert"),
+				"tls.key": []byte("key"),
+			},
+		}).Build(), nil
+	}
+
+	ct := CollectTask{
+		With: CollectInputs{
+			Versions: []Version{{
+				Name:    "default",
+				URL:     "https://default.example.com",
+				Method:  tasks.StringPointer("DELETE"),
+				Timeout: tasks.StringPointer("2s"),
+				HTTP2:   tasks.BoolPointer(true),
+				Host:    tasks.StringPointer("example.com"),
+				TLS: &TLS{
+					CASecret:           tasks.StringPointer("default/ca"),
+					CertSecret:         tasks.StringPointer("default/client"),
+					InsecureSkipVerify: tasks.BoolPointer(true),
+				},
+			}},
+		},
+	}
+	ct.InitializeDefaults()
+	assert.NoError(t, ct.validate())
+
+	options, args, files, err := ct.optionsForVersion(0)
+	defer func() {
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}()
+	assert.NoError(t, err)
+	assert.Equal(t, &RequestOptions{
+		Method:             "DELETE",
+		Timeout:            "2s",
+		Host:               "example.com",
+		HTTP2:              true,
+		TLS:                true,
+		MutualTLS:          true,
+		InsecureSkipVerify: true,
+	}, options)
+	assert.Equal(t, 3, len(files))
+	assert.Equal(t, []string{"-timeout", "2s", "-h2", "-k", "-cacert", files[0], "-cert", files[1], "-key", files[2]}, args)
+	content, err := ioutil.ReadFile(files[2])
+	assert.NoError(t, err)
+	assert.Equal(t, "key", string(content))
+
+	requests, err := ct.requestsForVersion(0, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "DELETE", *requests[0].method)
+	assert.Equal(t, "example.com", requests[0].headers["Host"])
+
+	ct.With.Versions[0].TLS.CertSecret = tasks.StringPointer("default/ca")
+	_, _, files, err = ct.optionsForVersion(0)
+	for _, f := range files {
+		os.Remove(f)
+	}
+	assert.Error(t, err)
+
+	ct.With.Versions[0].Timeout = tasks.StringPointer("soon")
+	assert.Error(t, ct.validate())
+}
+
+func TestAggregateRequestOptions(t *testing.T) {
+	o := aggregate(nil, "v1", &Result{RequestOptions: &RequestOptions{Method: "GET"}})
+	o = aggregate(o, "v1", &Result{})
+	assert.Equal(t, "GET", o["v1"].RequestOptions.Method)
+	o = aggregate(o, "v1", &Result{RequestOptions: &RequestOptions{Method: "PUT"}})
+	assert.Equal(t, "PUT", o["v1"].RequestOptions.Method)
+}
@@ -0,0 +1,323 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iter8-tools/handler/tasks"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ResultsAnnotation is the experiment annotation that records where the raw results of the
+	// most recent metrics/collect run were exported
+	ResultsAnnotation string = "iter8.tools/collect-results"
+
+	// maxConfigMapSize is the maximum size of the data in a config map
+	maxConfigMapSize int = 1024 * 1024
+
+	// artifactTimeLayout is the layout of the time of a run in the names of its artifacts
+	artifactTimeLayout string = "20060102T150405Z"
+)
+
+// ExportFormat is the format of exported results
+type ExportFormat string
+
+const (
+	// JSONExportFormat exports the Fortio-compatible result of each version as JSON
+	JSONExportFormat ExportFormat = "json"
+
+	// CSVExportFormat exports the duration histogram buckets of each version as CSV
+	CSVExportFormat ExportFormat = "csv"
+)
+
+// S3Export describes an S3-compatible object store into which results are exported
+type S3Export struct {
+	// endpoint of the object store, such as https://s3.us-east-1.amazonaws.com or http://minio.minio:9000
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// bucket into which results are exported
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// region of the bucket; optional; default us-east-1
+	Region *string `json:"region,omitempty" yaml:"region,omitempty"`
+	// prefix of the names of exported objects; optional
+	Prefix *string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	// secret containing credentials for the object store under the keys accessKeyID and secretAccessKey
+	Secret string `json:"secret" yaml:"secret"`
+}
+
+// Export describes where the raw results of each run of the collect task are exported.
+// Exported results are not aggregated across runs.
+type Export struct {
+	// formats of exported results; optional; default json
+	Formats []ExportFormat `json:"formats,omitempty" yaml:"formats,omitempty"`
+	// directory, such as the mount path of a persistent volume claim, into which results are written; optional
+	Path *string `json:"path,omitempty" yaml:"path,omitempty"`
+	// config map into which results are written, in the form namespace/name or name; optional
+	// the config map is created if it does not exist
+	ConfigMap *string `json:"configMap,omitempty" yaml:"configMap,omitempty"`
+	// S3-compatible object store into which results are written; optional
+	S3 *S3Export `json:"s3,omitempty" yaml:"s3,omitempty"`
+}
+
+// validate checks the export inputs
+func (e *Export) validate() error {
+	if e.Path == nil && e.ConfigMap == nil && e.S3 == nil {
+		return errors.New("export requires at least one of path, configMap and s3")
+	}
+	for _, f := range e.Formats {
+		if f != JSONExportFormat && f != CSVExportFormat {
+			return fmt.Errorf("unknown export format %s", f)
+		}
+	}
+	return nil
+}
+
+// resultsJSON renders the results of a run as JSON; the result of each version is Fortio-compatible
+func resultsJSON(results map[string]*Result) ([]byte, error) {
+	return json.MarshalIndent(results, "", "  ")
+}
+
+// resultsCSV renders the duration histogram buckets of each version in a run as CSV
+func resultsCSV(results map[string]*Result) ([]byte, error) {
+	versions := make([]string, 0, len(results))
+	for v := range results {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	if err := w.Write([]string{"version", "start", "end", "count"}); err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		for _, d := range results[v].DurationHistogram.Data {
+			if err := w.Write([]string{
+				v,
+				strconv.FormatFloat(d.Start, 'g', -1, 64),
+				strconv.FormatFloat(d.End, 'g', -1, 64),
+				strconv.Itoa(d.Count),
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// artifacts renders the results of a run in each export format, keyed by artifact name
+func (e *Export) artifacts(exp *tasks.Experiment, results map[string]*Result, now time.Time) (map[string][]byte, error) {
+	formats := e.Formats
+	if len(formats) == 0 {
+		formats = []ExportFormat{JSONExportFormat}
+	}
+	prefix := exp.Name + "-" + now.UTC().Format(artifactTimeLayout)
+	artifacts := make(map[string][]byte)
+	for _, f := range formats {
+		var content []byte
+		var err error
+		switch f {
+		case JSONExportFormat:
+			content, err = resultsJSON(results)
+		case CSVExportFormat:
+			content, err = resultsCSV(results)
+		}
+		if err != nil {
+			return nil, err
+		}
+		artifacts[prefix+"."+string(f)] = content
+	}
+	return artifacts, nil
+}
+
+// exportToPath writes artifacts into a directory, and returns their references
+func exportToPath(dir string, artifacts map[string][]byte) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	refs := []string{}
+	for name, content := range artifacts {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, content, 0644); err != nil {
+			return nil, err
+		}
+		refs = append(refs, "file://"+p)
+	}
+	return refs, nil
+}
+
+// artifactTime returns the time of the run whose artifact has the given name, if the name is that of an artifact
+func artifactTime(name string) (time.Time, bool) {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if len(name) < len(artifactTimeLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(artifactTimeLayout, name[len(name)-len(artifactTimeLayout):])
+	return t, err == nil
+}
+
+// rotate removes artifacts of the oldest runs from a config map until its data fits, keeping the given artifacts and any other keys
+func rotate(cm *corev1.ConfigMap, keep map[string][]byte) {
+	type entry struct {
+		name string
+		time time.Time
+	}
+	old := []entry{}
+	for name := range cm.Data {
+		if _, ok := keep[name]; ok {
+			continue
+		}
+		if t, ok := artifactTime(name); ok {
+			old = append(old, entry{name: name, time: t})
+		}
+	}
+	sort.Slice(old, func(i, j int) bool {
+		if old[i].time.Equal(old[j].time) {
+			return old[i].name < old[j].name
+		}
+		return old[i].time.Before(old[j].time)
+	})
+	for _, e := range old {
+		if configMapSize(cm) <= maxConfigMapSize {
+			return
+		}
+		delete(cm.Data, e.name)
+	}
+}
+
+// exportToConfigMap writes artifacts into a config map, creating it if needed, and returns their references.
+// Artifacts of the oldest runs are removed from the config map as needed to make room for the new ones.
+func exportToConfigMap(namespacedname string, artifacts map[string][]byte) ([]string, error) {
+	c, err := tasks.GetClient()
+	if err != nil {
+		return nil, err
+	}
+	// get the config map directly, rather than through tasks.GetConfigMap, since a missing
+	// config map is expected and need not be retried
+	nn := tasks.ToNamespacedName(namespacedname)
+	cm := &corev1.ConfigMap{}
+	err = c.Get(context.Background(), nn, cm)
+	create := false
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return nil, err
+		}
+		create = true
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: nn.Namespace,
+				Name:      nn.Name,
+			},
+		}
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+
+	refs := []string{}
+	for name, content := range artifacts {
+		cm.Data[name] = string(content)
+		refs = append(refs, "configmap://"+cm.Namespace+"/"+cm.Name+"/"+name)
+	}
+	rotate(cm, artifacts)
+	if configMapSize(cm) > maxConfigMapSize {
+		return nil, fmt.Errorf("results do not fit in config map %s/%s", cm.Namespace, cm.Name)
+	}
+
+	if create {
+		err = c.Create(context.Background(), cm)
+	} else {
+		err = c.Update(context.Background(), cm)
+	}
+	return refs, err
+}
+
+// configMapSize computes the size of the data in a config map
+func configMapSize(cm *corev1.ConfigMap) int {
+	size := 0
+	for k, v := range cm.Data {
+		size += len(k) + len(v)
+	}
+	for k, v := range cm.BinaryData {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// exportToS3 writes artifacts into an S3-compatible object store, and returns their references
+func exportToS3(s3 *S3Export, namespace string, artifacts map[string][]byte) ([]string, error) {
+	secret, err := tasks.GetSecret(s3.Secret)
+	if err != nil {
+		return nil, err
+	}
+	store := &s3Client{
+		endpoint:        strings.TrimSuffix(s3.Endpoint, "/"),
+		region:          "us-east-1",
+		accessKeyID:     string(secret.Data["accessKeyID"]),
+		secretAccessKey: string(secret.Data["secretAccessKey"]),
+	}
+	if s3.Region != nil {
+		store.region = *s3.Region
+	}
+	prefix := namespace + "/"
+	if s3.Prefix != nil {
+		prefix = strings.TrimSuffix(*s3.Prefix, "/") + "/" + prefix
+	}
+
+	refs := []string{}
+	for name, content := range artifacts {
+		key := prefix + name
+		if err := store.putObject(s3.Bucket, key, content); err != nil {
+			return nil, err
+		}
+		refs = append(refs, "s3://"+s3.Bucket+"/"+key)
+	}
+	return refs, nil
+}
+
+// export writes the results of a run to every destination, and returns references to the exported artifacts
+func (e *Export) export(exp *tasks.Experiment, results map[string]*Result) ([]string, error) {
+	artifacts, err := e.artifacts(exp, results, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []string{}
+	if e.Path != nil {
+		r, err := exportToPath(*e.Path, artifacts)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, r...)
+	}
+	if e.ConfigMap != nil {
+		r, err := exportToConfigMap(*e.ConfigMap, artifacts)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, r...)
+	}
+	if e.S3 != nil {
+		r, err := exportToS3(e.S3, exp.Namespace, artifacts)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, r...)
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
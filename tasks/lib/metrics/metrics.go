@@ -29,6 +29,9 @@ func MakeTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
 	case LibraryName + "/" + CollectTaskName:
 		bt, err := MakeCollect(t)
 		return bt, err
+	case LibraryName + "/" + QueryTaskName:
+		bt, err := MakeQuery(t)
+		return bt, err
 	default:
 		return nil, errors.New("Unknown task: " + t.Task)
 	}
@@ -44,8 +44,7 @@ var _ = Describe("metrics library", func() {
 
 			By("creating a metrics/collect task")
 			ct := CollectTask{
-				Library: "metrics",
-				Task:    "collect",
+				TaskMeta: tasks.TaskMeta{Library: "metrics", Task: "collect"},
 				With: CollectInputs{
 					Versions: []Version{
 						{
@@ -119,8 +118,7 @@ var _ = Describe("metrics library", func() {
 
 			By("creating a metrics/collect task")
 			ct := CollectTask{
-				Library: "metrics",
-				Task:    "collect",
+				TaskMeta: tasks.TaskMeta{Library: "metrics", Task: "collect"},
 				With: CollectInputs{
 					LoadOnly: tasks.BoolPointer(true),
 					Versions: []Version{
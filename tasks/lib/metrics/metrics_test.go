@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 )
@@ -47,3 +48,27 @@ func TestMakeTask(t *testing.T) {
 	assert.Nil(t, task)
 	assert.Error(t, err)
 }
+
+func TestCommonInputs(t *testing.T) {
+	for _, spec := range []*v2alpha2.TaskSpec{{
+		Task: "metrics/collect",
+		With: map[string]v1.JSON{
+			"versions":        {Raw: []byte(`[{"name": "test", "url": "https://iter8.tools"}]`)},
+			"strictTemplates": {Raw: []byte(`true`)},
+		},
+	}, {
+		Task: "metrics/query",
+		With: map[string]v1.JSON{
+			"url":             {Raw: []byte(`"http://prometheus:9090/api/v1/query"`)},
+			"metrics":         {Raw: []byte(`[{"name": "request-rate", "query": "sum(rate(requests[60s]))"}]`)},
+			"strictTemplates": {Raw: []byte(`true`)},
+		},
+	}} {
+		task, err := MakeTask(spec)
+		assert.NoError(t, err)
+		assert.NoError(t, tasks.Configure(task, spec))
+		// both tasks of the library keep the inputs common to all tasks in the same way
+		meta := task.(interface{ GetCommonInputs() *tasks.CommonInputs })
+		assert.True(t, *meta.GetCommonInputs().StrictTemplates, spec.Task)
+	}
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iter8-tools/handler/tasks"
+)
+
+// DefaultPushgatewayJob is the default job name used when pushing metrics to a Prometheus Pushgateway
+const DefaultPushgatewayJob string = "iter8"
+
+// Pushgateway describes a Prometheus Pushgateway to which built-in metrics are pushed.
+// Metrics are grouped by job, experiment and namespace, and labeled by version.
+type Pushgateway struct {
+	// URL of the Pushgateway, such as http://pushgateway.monitoring:9091
+	URL string `json:"url" yaml:"url"`
+	// job name used to group the pushed metrics; optional; default iter8
+	Job *string `json:"job,omitempty" yaml:"job,omitempty"`
+}
+
+// escapeLabelValue escapes a label value for the Prometheus text exposition format
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatFloat formats a sample value for the Prometheus text exposition format
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// latencyBuckets are the upper bounds (in seconds) of the buckets of the latency histogram; these match Fortio
+var latencyBuckets = []float64{
+	0.001, 0.002, 0.003, 0.004, 0.005, 0.006, 0.007, 0.008, 0.009, 0.01,
+	0.011, 0.012, 0.014, 0.016, 0.018, 0.02, 0.025, 0.03, 0.035, 0.04, 0.045, 0.05,
+	0.06, 0.07, 0.08, 0.09, 0.1, 0.2, 0.3, 0.4, 0.5, 0.75, 1, 2, 3, 4, 5, 7.5, 10,
+	20, 30, 40, 50, 60, 70, 80, 90, 100,
+}
+
+// exposition renders built-in metrics of each version in the Prometheus text exposition format
+func exposition(results map[string]*Result) []byte {
+	versions := make([]string, 0, len(results))
+	for v := range results {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintln(buf, "# HELP iter8_collect_request_count Number of requests sent to the version.")
+	fmt.Fprintln(buf, "# TYPE iter8_collect_request_count counter")
+	for _, v := range versions {
+		fmt.Fprintf(buf, "iter8_collect_request_count{version=\"%s\"} %d\n", escapeLabelValue(v), results[v].DurationHistogram.Count)
+	}
+
+	fmt.Fprintln(buf, "# HELP iter8_collect_response_count Number of responses from the version by return code.")
+	fmt.Fprintln(buf, "# TYPE iter8_collect_response_count counter")
+	for _, v := range versions {
+		codes := make([]string, 0, len(results[v].RetCodes))
+		for c := range results[v].RetCodes {
+			codes = append(codes, c)
+		}
+		sort.Strings(codes)
+		for _, c := range codes {
+			fmt.Fprintf(buf, "iter8_collect_response_count{version=\"%s\",code=\"%s\"} %d\n", escapeLabelValue(v), escapeLabelValue(c), results[v].RetCodes[c])
+		}
+	}
+
+	fmt.Fprintln(buf, "# HELP iter8_collect_assertion_check_count Number of responses from the version that were checked against assertions.")
+	fmt.Fprintln(buf, "# TYPE iter8_collect_assertion_check_count counter")
+	for _, v := range versions {
+		fmt.Fprintf(buf, "iter8_collect_assertion_check_count{version=\"%s\"} %d\n", escapeLabelValue(v), results[v].AssertionChecks)
+	}
+
+	fmt.Fprintln(buf, "# HELP iter8_collect_assertion_error_count Number of checked responses from the version that failed assertions.")
+	fmt.Fprintln(buf, "# TYPE iter8_collect_assertion_error_count counter")
+	for _, v := range versions {
+		fmt.Fprintf(buf, "iter8_collect_assertion_error_count{version=\"%s\"} %d\n", escapeLabelValue(v), results[v].AssertionErrors)
+	}
+
+	fmt.Fprintln(buf, "# HELP iter8_collect_max_latency_seconds Maximum latency of requests sent to the version.")
+	fmt.Fprintln(buf, "# TYPE iter8_collect_max_latency_seconds gauge")
+	for _, v := range versions {
+		fmt.Fprintf(buf, "iter8_collect_max_latency_seconds{version=\"%s\"} %s\n", escapeLabelValue(v), formatFloat(results[v].DurationHistogram.Max))
+	}
+
+	// histogram samples are assigned to the bucket containing the end of their range
+	fmt.Fprintln(buf, "# HELP iter8_collect_latency_seconds Latency of requests sent to the version.")
+	fmt.Fprintln(buf, "# TYPE iter8_collect_latency_seconds histogram")
+	for _, v := range versions {
+		dh := results[v].DurationHistogram
+		for _, le := range latencyBuckets {
+			count := 0
+			for _, d := range dh.Data {
+				if d.End <= le {
+					count += d.Count
+				}
+			}
+			fmt.Fprintf(buf, "iter8_collect_latency_seconds_bucket{version=\"%s\",le=\"%s\"} %d\n", escapeLabelValue(v), formatFloat(le), count)
+		}
+		fmt.Fprintf(buf, "iter8_collect_latency_seconds_bucket{version=\"%s\",le=\"+Inf\"} %d\n", escapeLabelValue(v), dh.Count)
+		fmt.Fprintf(buf, "iter8_collect_latency_seconds_sum{version=\"%s\"} %s\n", escapeLabelValue(v), formatFloat(dh.Sum))
+		fmt.Fprintf(buf, "iter8_collect_latency_seconds_count{version=\"%s\"} %d\n", escapeLabelValue(v), dh.Count)
+	}
+
+	return buf.Bytes()
+}
+
+// push replaces the metrics of the experiment in the Pushgateway with built-in metrics of each version
+func (p *Pushgateway) push(ctx context.Context, exp *tasks.Experiment, results map[string]*Result) error {
+	job := DefaultPushgatewayJob
+	if p.Job != nil {
+		job = *p.Job
+	}
+	u := strings.TrimSuffix(p.URL, "/") +
+		"/metrics/job/" + url.PathEscape(job) +
+		"/experiment/" + url.PathEscape(exp.Name) +
+		"/namespace/" + url.PathEscape(exp.Namespace)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(exposition(results)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	var httpClient = &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: tasks.TracedTransport(nil),
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unable to push metrics: %s %s", resp.Status, string(body))
+	}
+	return nil
+}
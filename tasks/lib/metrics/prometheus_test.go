@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExposition(t *testing.T) {
+	results := exportResults()
+	results["default"].AssertionChecks = 2
+	results["default"].AssertionErrors = 1
+	text := string(exposition(results))
+	assert.Contains(t, text, "# TYPE iter8_collect_latency_seconds histogram\n")
+	assert.Contains(t, text, "iter8_collect_request_count{version=\"default\"} 3\n")
+	assert.Contains(t, text, "iter8_collect_response_count{version=\"default\",code=\"200\"} 3\n")
+	assert.Contains(t, text, "iter8_collect_assertion_check_count{version=\"default\"} 2\n")
+	assert.Contains(t, text, "iter8_collect_assertion_error_count{version=\"default\"} 1\n")
+	assert.Contains(t, text, "iter8_collect_max_latency_seconds{version=\"default\"} 0.02\n")
+	assert.Contains(t, text, "iter8_collect_latency_seconds_bucket{version=\"default\",le=\"0.005\"} 0\n")
+	assert.Contains(t, text, "iter8_collect_latency_seconds_bucket{version=\"default\",le=\"0.01\"} 2\n")
+	assert.Contains(t, text, "iter8_collect_latency_seconds_bucket{version=\"default\",le=\"0.02\"} 3\n")
+	assert.Contains(t, text, "iter8_collect_latency_seconds_bucket{version=\"default\",le=\"+Inf\"} 3\n")
+	assert.Contains(t, text, "iter8_collect_latency_seconds_sum{version=\"default\"} 0.03\n")
+	assert.Contains(t, text, "iter8_collect_latency_seconds_count{version=\"default\"} 3\n")
+
+	assert.Equal(t, `a\"b\\c\n`, escapeLabelValue("a\"b\\c\n"))
+}
+
+func TestPush(t *testing.T) {
+	var method, path, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer srv.Close()
+
+	exp := &tasks.Experiment{}
+	exp.Name = "exp"
+	exp.Namespace = "default"
+
+	p := &Pushgateway{URL: srv.URL + "/"}
+	assert.NoError(t, p.push(context.Background(), exp, exportResults()))
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/metrics/job/iter8/experiment/exp/namespace/default", path)
+	assert.Contains(t, body, "iter8_collect_request_count{version=\"default\"} 3\n")
+
+	p.Job = tasks.StringPointer("load")
+	assert.NoError(t, p.push(context.Background(), exp, exportResults()))
+	assert.Equal(t, "/metrics/job/load/experiment/exp/namespace/default", path)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	assert.Error(t, (&Pushgateway{URL: failing.URL}).push(context.Background(), exp, exportResults()))
+}
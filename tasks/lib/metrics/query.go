@@ -0,0 +1,355 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	// QueryTaskName is the name of the task this file implements
+	QueryTaskName string = "query"
+
+	// DefaultJSONPath is the JSON path of the value in the response of a Prometheus instant query
+	DefaultJSONPath string = ".data.result[0].value[1]"
+)
+
+// QueryMetric describes a metric whose value is queried for each version.
+// The query, params and body are interpolated using the variables of each version,
+// the experiment (as this), the secret (as secret), and the seconds elapsed since the start of the experiment (as elapsedTime).
+type QueryMetric struct {
+	// name of the metric in the experiment status
+	Name string `json:"name" yaml:"name"`
+	// PromQL query sent as the query param; optional
+	Query *string `json:"query,omitempty" yaml:"query,omitempty"`
+	// other params of the request; optional
+	Params []v2alpha2.NamedValue `json:"params,omitempty" yaml:"params,omitempty"`
+	// body of the request; optional
+	Body *string `json:"body,omitempty" yaml:"body,omitempty"`
+	// JSON path of the value in the response; optional; default .data.result[0].value[1]
+	JSONPath *string `json:"jsonPath,omitempty" yaml:"jsonPath,omitempty"`
+}
+
+// QueryInputs contain the inputs to the metrics query task
+type QueryInputs struct {
+	// URL of the metrics backend, such as http://prometheus.istio-system:9090/api/v1/query; interpolated
+	URL string `json:"url" yaml:"url"`
+	// HTTP method of the request; optional; default GET
+	Method *v2alpha2.MethodType `json:"method,omitempty" yaml:"method,omitempty"`
+	// type of authentication; optional
+	// Basic uses the username and password keys of the secret, and Bearer uses its token key;
+	// APIKey relies on headers interpolated using the secret
+	AuthType *v2alpha2.AuthType `json:"authType,omitempty" yaml:"authType,omitempty"`
+	// secret used for authentication, in the form namespace/name or name; optional
+	Secret *string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	// headers of the request; interpolated; optional
+	Headers []v2alpha2.NamedValue `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// names of versions to query; optional; default all versions of the experiment
+	Versions []string `json:"versions,omitempty" yaml:"versions,omitempty"`
+	// metrics to query
+	Metrics []QueryMetric `json:"metrics" yaml:"metrics"`
+}
+
+// QueryTask queries a metrics backend, such as Prometheus, for the value of metrics of each version,
+// and records the values with the result of each version in the aggregated builtin hists of the experiment status.
+// The aggregated metrics of the status are not used, since etc3 replaces them in each iteration; see QueriedMetrics.
+type QueryTask struct {
+	tasks.TaskMeta `json:",inline" yaml:",inline"`
+	With           QueryInputs `json:"with" yaml:"with"`
+}
+
+// MakeQuery constructs a QueryTask out of a query task spec
+func MakeQuery(t *v2alpha2.TaskSpec) (tasks.Task, error) {
+	if t.Task != LibraryName+"/"+QueryTaskName {
+		return nil, errors.New("library and task need to be " + LibraryName + " and " + QueryTaskName)
+	}
+	jsonBytes, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	qt := &QueryTask{}
+	if err = json.Unmarshal(jsonBytes, qt); err != nil {
+		return nil, err
+	}
+	if err = qt.validate(); err != nil {
+		return nil, err
+	}
+	return qt, nil
+}
+
+// validate checks the inputs of the task
+func (t *QueryTask) validate() error {
+	if t.With.URL == "" {
+		return errors.New("query task requires a url")
+	}
+	if len(t.With.Metrics) == 0 {
+		return errors.New("query task requires at least one metric")
+	}
+	for _, m := range t.With.Metrics {
+		if m.Name == "" {
+			return errors.New("query task requires a name for each metric")
+		}
+		if err := jsonpath.New(m.Name).Parse(tasks.JSONPathTemplate(m.jsonPath())); err != nil {
+			return fmt.Errorf("invalid json path for metric %s: %s", m.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// jsonPath returns the JSON path of the value of the metric in the response
+func (m *QueryMetric) jsonPath() string {
+	if m.JSONPath != nil {
+		return *m.JSONPath
+	}
+	return DefaultJSONPath
+}
+
+// versions returns the names of the versions to query
+func (t *QueryTask) versions(exp *tasks.Experiment) []string {
+	if len(t.With.Versions) > 0 {
+		return t.With.Versions
+	}
+	versions := []string{}
+	if exp.Spec.VersionInfo != nil {
+		versions = append(versions, exp.Spec.VersionInfo.Baseline.Name)
+		for _, c := range exp.Spec.VersionInfo.Candidates {
+			versions = append(versions, c.Name)
+		}
+	}
+	return versions
+}
+
+// prepareRequest constructs the request that queries a metric using the given tags
+func (t *QueryTask) prepareRequest(m *QueryMetric, tags *tasks.Tags) (*http.Request, error) {
+	u, err := tags.Interpolate(&t.With.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	method := v2alpha2.GETMethodType
+	if t.With.Method != nil {
+		method = *t.With.Method
+	}
+
+	var body *bytes.Reader
+	if m.Body != nil {
+		b, err := tags.Interpolate(m.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader([]byte(b))
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(string(method), u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	if m.Query != nil {
+		query, err := tags.Interpolate(m.Query)
+		if err != nil {
+			return nil, err
+		}
+		q.Set("query", query)
+	}
+	for _, p := range m.Params {
+		value, err := tags.Interpolate(&p.Value)
+		if err != nil {
+			return nil, err
+		}
+		q.Set(p.Name, value)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	if m.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, h := range t.With.Headers {
+		value, err := tags.Interpolate(&h.Value)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(h.Name, value)
+	}
+
+	if t.With.AuthType != nil {
+		secret, _ := tags.M["secret"].(map[string]interface{})
+		switch *t.With.AuthType {
+		case v2alpha2.BasicAuthType:
+			username, _ := secret["username"].(string)
+			password, _ := secret["password"].(string)
+			req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+		case v2alpha2.BearerAuthType:
+			token, _ := secret["token"].(string)
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	return req, nil
+}
+
+// queryValue queries the value of a metric using the given tags.
+// The returned value is nil if the response does not contain a numeric value, such as when a query matches no series.
+func (t *QueryTask) queryValue(entry *logrus.Entry, m *QueryMetric, tags *tasks.Tags) (*float64, error) {
+	req, err := t.prepareRequest(m, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	var httpClient = &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: tasks.TracedTransport(nil),
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("query for metric %s failed: %s %s", m.Name, resp.Status, string(body))
+	}
+
+	var obj interface{}
+	if err = json.Unmarshal(body, &obj); err != nil {
+		return nil, err
+	}
+	p := jsonpath.New(m.Name)
+	if err = p.Parse(tasks.JSONPathTemplate(m.jsonPath())); err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err = p.Execute(buf, obj); err != nil {
+		entry.Warn("no value for metric ", m.Name, ": ", err)
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(buf.String()), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		entry.Warn("value for metric ", m.Name, " is not a number: ", buf.String())
+		return nil, nil
+	}
+	return &value, nil
+}
+
+// Run executes the metrics/query task
+func (t *QueryTask) Run(ctx context.Context) error {
+	exp, err := tasks.GetExperimentFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var secret *corev1.Secret
+	if t.With.Secret != nil {
+		if secret, err = tasks.GetSecret(*t.With.Secret); err != nil {
+			return err
+		}
+	}
+
+	elapsedTime := int64(0)
+	if exp.Status.StartTime != nil {
+		elapsedTime = int64(time.Since(exp.Status.StartTime.Time).Seconds())
+	}
+
+	versions := t.versions(exp)
+	if len(versions) == 0 {
+		tasks.ReportSkipped(ctx, "no versions to query")
+		return nil
+	}
+
+	// values of metrics by version and metric, which are written to the status of the experiment once all are queried
+	values := make(map[string]map[string]float64)
+	for _, version := range versions {
+		entry := log.WithField(tasks.VersionLogField, version)
+		tags := tasks.ExperimentTags(ctx, exp).
+			With("elapsedTime", elapsedTime).
+			WithVersion(&exp.Experiment, version)
+		// log tags now before secret is added; we don't log the secret
+		entry.Trace("tags without secrets: ", tags)
+		tags = tags.WithSecret("secret", secret).WithSecrets(secret)
+
+		for i := range t.With.Metrics {
+			m := &t.With.Metrics[i]
+			value, err := t.queryValue(entry, m, &tags)
+			if err != nil {
+				entry.Error("unable to query metric ", m.Name, " for version ", version, ": ", err)
+				return err
+			}
+			if value == nil {
+				continue
+			}
+			entry.Info("metric ", m.Name, " for version ", version, ": ", *value)
+			if values[version] == nil {
+				values[version] = make(map[string]float64)
+			}
+			values[version][m.Name] = *value
+		}
+	}
+
+	// only the values of the queried metrics are written, since etc3 may have changed other fields of the status;
+	// they are added to the results of each version in the aggregated builtin hists, which etc3 keeps across iterations
+	return tasks.UpdateInClusterExperimentStatus(exp, func(e *tasks.Experiment) error {
+		results, err := builtinResults(e)
+		if err != nil {
+			return err
+		}
+		for version, metrics := range values {
+			res, ok := results[version]
+			if !ok {
+				res = &Result{}
+				results[version] = res
+			}
+			if res.QueriedMetrics == nil {
+				res.QueriedMetrics = make(map[string]float64)
+			}
+			for metric, value := range metrics {
+				res.QueriedMetrics[metric] = value
+			}
+		}
+		bytes, err := json.Marshal(results)
+		if err != nil {
+			return err
+		}
+		e.SetAggregatedBuiltinHists(v1.JSON{Raw: bytes})
+		return nil
+	})
+}
+
+// QueriedMetrics returns the most recent values of metrics queried by the metrics/query task, keyed by metric and version
+func QueriedMetrics(e *tasks.Experiment) (map[string]map[string]float64, error) {
+	results, err := builtinResults(e)
+	if err != nil {
+		return nil, err
+	}
+	metrics := make(map[string]map[string]float64)
+	for version, res := range results {
+		for metric, value := range res.QueriedMetrics {
+			if metrics[metric] == nil {
+				metrics[metric] = make(map[string]float64)
+			}
+			metrics[metric][version] = value
+		}
+	}
+	return metrics, nil
+}
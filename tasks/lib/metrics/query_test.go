@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakePrometheus responds to instant queries with the value of the revision in the query
+func fakePrometheus() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		value := ""
+		switch r.URL.Query().Get("query") {
+		case `sum(rate(requests{revision="revision1"}[60s]))`:
+			value = "12.5"
+		case `sum(rate(requests{revision="revision2"}[60s]))`:
+			value = "NaN"
+		default:
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1625000000,"%s"]}]}}`, value)
+	}))
+}
+
+func TestMakeQuery(t *testing.T) {
+	task, err := MakeTask(&v2alpha2.TaskSpec{
+		Task: LibraryName + "/" + QueryTaskName,
+		With: map[string]v1.JSON{
+			"url":     {Raw: []byte(`"http://prometheus:9090/api/v1/query"`)},
+			"metrics": {Raw: []byte(`[{"name": "request-rate", "query": "sum(rate(requests[1m]))"}]`)},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "request-rate", task.(*QueryTask).With.Metrics[0].Name)
+
+	_, err = MakeTask(&v2alpha2.TaskSpec{
+		Task: LibraryName + "/" + QueryTaskName,
+		With: map[string]v1.JSON{
+			"url":     {Raw: []byte(`"http://prometheus:9090/api/v1/query"`)},
+			"metrics": {Raw: []byte(`[{"name": "request-rate", "jsonPath": "{.data["}]`)},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func TestQueryRun(t *testing.T) {
+	srv := fakePrometheus()
+	defer srv.Close()
+
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../../../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+
+	scheme := runtime.NewScheme()
+	metav1.AddToGroupVersion(scheme, v2alpha2.GroupVersion)
+	scheme.AddKnownTypes(v2alpha2.GroupVersion, &tasks.Experiment{})
+	assert.NoError(t, corev1.AddToScheme(scheme))
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(exp, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "prometheus",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			"username": []byte("admin"),
+			"password": []byte("secret"),
+		},
+	}).Build()
+	tasks.GetClient = func() (client.Client, error) {
+		return c, nil
+	}
+
+	basic := v2alpha2.BasicAuthType
+	qt := &QueryTask{
+		With: QueryInputs{
+			URL:      srv.URL + "/api/v1/query",
+			AuthType: &basic,
+			Secret:   tasks.StringPointer("default/prometheus"),
+			Metrics: []QueryMetric{{
+				Name:  "request-rate",
+				Query: tasks.StringPointer(`sum(rate(requests{revision="{{ .revision }}"}[60s]))`),
+			}},
+		},
+	}
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+	assert.NoError(t, qt.Run(ctx))
+
+	// the status is updated in the cluster
+	updated := &tasks.Experiment{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(exp), updated))
+
+	// etc3 replaces the analysis of the experiment in each iteration, and keeps only the aggregated builtin hists
+	updated.Status.Analysis = &v2alpha2.Analysis{
+		AggregatedBuiltinHists: updated.Status.Analysis.AggregatedBuiltinHists,
+	}
+	metrics, err := QueriedMetrics(updated)
+	assert.NoError(t, err)
+	assert.Equal(t, 12.5, metrics["request-rate"]["default"])
+	// NaN values are not recorded
+	_, ok := metrics["request-rate"]["canary"]
+	assert.False(t, ok)
+
+	// failed queries fail the task
+	qt.With.Secret = nil
+	assert.Error(t, qt.Run(ctx))
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iter8-tools/handler/tasks"
+)
+
+// s3Client writes objects into an S3-compatible object store using path-style requests
+// signed with AWS Signature Version 4
+type s3Client struct {
+	endpoint        string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	// now is useful for test mocks
+	now func() time.Time
+}
+
+// hmacSHA256 computes the HMAC-SHA256 of data using key
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sha256Hex computes the hex encoded SHA256 of data
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// escapePath URI encodes each segment of an object path
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sign adds the headers of AWS Signature Version 4 to a request with the given payload hash
+func (c *s3Client) sign(req *http.Request, payloadHash string) {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secretAccessKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKeyID, scope, signedHeaders, signature))
+}
+
+// putObject writes content into the object with the given key in a bucket
+func (c *s3Client) putObject(bucket string, key string, content []byte) error {
+	req, err := http.NewRequest(http.MethodPut, c.endpoint+"/"+escapePath(bucket+"/"+key), bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	c.sign(req, sha256Hex(content))
+
+	var httpClient = &http.Client{
+		Timeout:   time.Second * 30,
+		Transport: tasks.TracedTransport(nil),
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Error("unable to put object: ", string(body))
+		return fmt.Errorf("unable to put object %s in bucket %s: %s", key, bucket, resp.Status)
+	}
+	return nil
+}
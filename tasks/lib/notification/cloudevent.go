@@ -0,0 +1,264 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+const (
+	// CloudEventTaskName is the name of the task this file implements
+	CloudEventTaskName string = "cloudevent"
+
+	// CloudEventsSpecVersion is the version of the CloudEvents specification of emitted events
+	CloudEventsSpecVersion string = "1.0"
+
+	// ExperimentStartedEventType is the type of events emitted when an experiment starts
+	ExperimentStartedEventType string = "tools.iter8.experiment.started"
+	// ExperimentCompletedEventType is the type of events emitted when an experiment completes
+	ExperimentCompletedEventType string = "tools.iter8.experiment.completed"
+	// ExperimentFailedEventType is the type of events emitted when an experiment fails
+	ExperimentFailedEventType string = "tools.iter8.experiment.failed"
+	// ExperimentPromotedEventType is the type of events emitted when a version of an experiment is promoted
+	ExperimentPromotedEventType string = "tools.iter8.experiment.promoted"
+)
+
+// CloudEventMode is the content mode of the HTTP binding of a CloudEvent
+type CloudEventMode string
+
+const (
+	// BinaryCloudEventMode carries event attributes in headers and event data in the body
+	BinaryCloudEventMode CloudEventMode = "binary"
+
+	// StructuredCloudEventMode carries the entire event, including attributes, in the body
+	StructuredCloudEventMode CloudEventMode = "structured"
+)
+
+// CloudEventInputs contain the inputs to the task
+type CloudEventInputs struct {
+	// URL of the event sink, such as a Knative Eventing broker
+	URL string `json:"URL" yaml:"URL"`
+	// content mode; one of binary and structured; optional; default binary
+	Mode *CloudEventMode `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// type of the event; optional; by default, the type is
+	// tools.iter8.experiment.failed if the experiment has failed,
+	// tools.iter8.experiment.promoted if it has completed with a version recommended for promotion,
+	// tools.iter8.experiment.completed if it has completed otherwise, and
+	// tools.iter8.experiment.started otherwise
+	Type *string `json:"type,omitempty" yaml:"type,omitempty"`
+	// template of the source of the event; optional; default /apis/iter8.tools/v2alpha2/namespaces/<namespace>/experiments/<name>
+	Source *string `json:"source,omitempty" yaml:"source,omitempty"`
+	// template of the subject of the event; optional; default is the version recommended for promotion, if any
+	Subject *string `json:"subject,omitempty" yaml:"subject,omitempty"`
+	// additional headers of the request; interpolated; optional
+	Headers []v2alpha2.NamedValue `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Inputs  `json:",inline" yaml:",inline"`
+}
+
+// CloudEventTask emits a CloudEvent about the experiment over HTTP.
+type CloudEventTask struct {
+	tasks.TaskMeta `json:",inline" yaml:",inline"`
+	With           CloudEventInputs `json:"with" yaml:"with"`
+}
+
+// cloudEventData is the data of emitted CloudEvents; it summarizes the experiment
+type cloudEventData struct {
+	Name              string   `json:"name" yaml:"name"`
+	Namespace         string   `json:"namespace" yaml:"namespace"`
+	Target            string   `json:"target" yaml:"target"`
+	TestingPattern    string   `json:"testingPattern" yaml:"testingPattern"`
+	Versions          []string `json:"versions" yaml:"versions"`
+	Stage             string   `json:"stage" yaml:"stage"`
+	Failed            bool     `json:"failed" yaml:"failed"`
+	experimentsummary `json:",inline" yaml:",inline"`
+}
+
+// cloudEvent is the structured representation of a CloudEvent
+type cloudEvent struct {
+	SpecVersion     string         `json:"specversion"`
+	ID              string         `json:"id"`
+	Source          string         `json:"source"`
+	Type            string         `json:"type"`
+	Subject         string         `json:"subject,omitempty"`
+	Time            string         `json:"time"`
+	DataContentType string         `json:"datacontenttype"`
+	Data            cloudEventData `json:"data"`
+}
+
+// MakeCloudEventTask converts a cloudevent task spec into a CloudEventTask.
+func MakeCloudEventTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
+	task := &CloudEventTask{}
+	if err := unmarshalTask(t, CloudEventTaskName, task); err != nil {
+		return nil, err
+	}
+	if task.With.URL == "" {
+		return nil, errors.New("cloudevent task requires a url")
+	}
+	if m := task.With.Mode; m != nil && *m != BinaryCloudEventMode && *m != StructuredCloudEventMode {
+		return nil, fmt.Errorf("unknown mode %s", *m)
+	}
+	return task, nil
+}
+
+// Run the task. Ignores failures unless the task indicates ignoreFailure: false
+func (t *CloudEventTask) Run(ctx context.Context) error {
+	return t.With.run(ctx, t.internalRun)
+}
+
+// Actual task runner
+func (t *CloudEventTask) internalRun(ctx context.Context) error {
+	exp, err := tasks.GetExperimentFromContext(ctx)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	event, err := t.event(ctx, exp, time.Now())
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	req, err := t.prepareRequest(ctx, exp, event)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	var httpClient = &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: tasks.TracedTransport(nil),
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("event sink returned %s: %s", resp.Status, string(body))
+		log.Error(err)
+		return err
+	}
+	log.Info("emitted event ", event.Type, " with id ", event.ID)
+	return nil
+}
+
+// eventType returns the type of the event about an experiment
+func (t *CloudEventTask) eventType(e *tasks.Experiment) string {
+	if t.With.Type != nil {
+		return *t.With.Type
+	}
+	if Failed(e) {
+		return ExperimentFailedEventType
+	}
+	if e.Status.Stage != nil && *e.Status.Stage == v2alpha2.ExperimentStageCompleted {
+		if e.Status.VersionRecommendedForPromotion != nil {
+			return ExperimentPromotedEventType
+		}
+		return ExperimentCompletedEventType
+	}
+	return ExperimentStartedEventType
+}
+
+// event constructs the event about an experiment
+func (t *CloudEventTask) event(ctx context.Context, e *tasks.Experiment, now time.Time) (*cloudEvent, error) {
+	tags := tasks.ExperimentTags(ctx, e).
+		With("summary", summaryObject(e))
+
+	var err error
+	source := "/apis/" + v2alpha2.GroupVersion.String() + "/namespaces/" + e.Namespace + "/experiments/" + e.Name
+	if t.With.Source != nil {
+		if source, err = tags.Interpolate(t.With.Source); err != nil {
+			return nil, err
+		}
+	}
+	subject := ""
+	if e.Status.VersionRecommendedForPromotion != nil {
+		subject = *e.Status.VersionRecommendedForPromotion
+	}
+	if t.With.Subject != nil {
+		if subject, err = tags.Interpolate(t.With.Subject); err != nil {
+			return nil, err
+		}
+	}
+
+	return &cloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              string(uuid.NewUUID()),
+		Source:          source,
+		Type:            t.eventType(e),
+		Subject:         subject,
+		Time:            now.UTC().Format(time.RFC3339Nano),
+		DataContentType: "application/json",
+		Data: cloudEventData{
+			Name:              e.Name,
+			Namespace:         e.Namespace,
+			Target:            e.Spec.Target,
+			TestingPattern:    string(e.Spec.Strategy.TestingPattern),
+			Versions:          versionNames(e),
+			Stage:             Stage(e),
+			Failed:            Failed(e),
+			experimentsummary: newExperimentSummary(e.Experiment),
+		},
+	}, nil
+}
+
+// prepareRequest constructs the HTTP request that carries the event in the configured content mode
+func (t *CloudEventTask) prepareRequest(ctx context.Context, e *tasks.Experiment, event *cloudEvent) (*http.Request, error) {
+	mode := BinaryCloudEventMode
+	if t.With.Mode != nil {
+		mode = *t.With.Mode
+	}
+
+	var body []byte
+	var err error
+	if mode == StructuredCloudEventMode {
+		body, err = json.Marshal(event)
+	} else {
+		body, err = json.Marshal(event.Data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.With.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == StructuredCloudEventMode {
+		req.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+	} else {
+		req.Header.Set("Content-Type", event.DataContentType)
+		req.Header.Set("ce-specversion", event.SpecVersion)
+		req.Header.Set("ce-id", event.ID)
+		req.Header.Set("ce-source", event.Source)
+		req.Header.Set("ce-type", event.Type)
+		req.Header.Set("ce-time", event.Time)
+		if event.Subject != "" {
+			req.Header.Set("ce-subject", event.Subject)
+		}
+	}
+
+	if len(t.With.Headers) > 0 {
+		tags := tasks.ExperimentTags(ctx, e)
+		for _, h := range t.With.Headers {
+			value, err := tags.Interpolate(&h.Value)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set(h.Name, value)
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,120 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestMakeCloudEventTask(t *testing.T) {
+	task, err := MakeTask(&v2alpha2.TaskSpec{
+		Task: LibraryName + "/" + CloudEventTaskName,
+		With: map[string]apiextensionsv1.JSON{
+			"URL":  {Raw: []byte(`"http://broker-ingress.knative-eventing.svc.cluster.local/default/default"`)},
+			"mode": {Raw: []byte(`"structured"`)},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, StructuredCloudEventMode, *task.(*CloudEventTask).With.Mode)
+
+	_, err = MakeTask(&v2alpha2.TaskSpec{
+		Task: LibraryName + "/" + CloudEventTaskName,
+		With: map[string]apiextensionsv1.JSON{
+			"URL":  {Raw: []byte(`"http://broker"`)},
+			"mode": {Raw: []byte(`"batched"`)},
+		},
+	})
+	assert.Error(t, err)
+
+	// a url is required
+	_, err = MakeTask(&v2alpha2.TaskSpec{
+		Task: LibraryName + "/" + CloudEventTaskName,
+		With: map[string]apiextensionsv1.JSON{
+			"mode": {Raw: []byte(`"structured"`)},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func TestEventType(t *testing.T) {
+	task := &CloudEventTask{}
+	for file, eventType := range map[string]string{
+		"slack1.yaml": ExperimentPromotedEventType,
+		"slack3.yaml": ExperimentFailedEventType,
+	} {
+		exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", file)).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, eventType, task.eventType(exp), file)
+	}
+
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack1.yaml")).Build()
+	assert.NoError(t, err)
+	exp.Status.VersionRecommendedForPromotion = nil
+	assert.Equal(t, ExperimentCompletedEventType, task.eventType(exp))
+	exp.Status.Stage = nil
+	assert.Equal(t, ExperimentStartedEventType, task.eventType(exp))
+
+	task.With.Type = tasks.StringPointer(ExperimentCompletedEventType)
+	assert.Equal(t, ExperimentCompletedEventType, task.eventType(exp))
+}
+
+func TestCloudEventModes(t *testing.T) {
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack1.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+
+	// binary mode
+	task := &CloudEventTask{With: CloudEventInputs{
+		URL:     srv.URL,
+		Headers: []v2alpha2.NamedValue{{Name: "X-Experiment", Value: "{{ .this.metadata.name }}"}},
+		Inputs:  Inputs{IgnoreFailure: tasks.BoolPointer(false)},
+	}}
+	assert.NoError(t, task.Run(ctx))
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, CloudEventsSpecVersion, header.Get("ce-specversion"))
+	assert.NotEmpty(t, header.Get("ce-id"))
+	assert.Equal(t, "/apis/iter8.tools/v2alpha2/namespaces/default/experiments/conformance-exp", header.Get("ce-source"))
+	assert.Equal(t, ExperimentPromotedEventType, header.Get("ce-type"))
+	assert.Equal(t, "productpage-v1", header.Get("ce-subject"))
+	assert.NotEmpty(t, header.Get("ce-time"))
+	assert.Equal(t, "conformance-exp", header.Get("X-Experiment"))
+	data := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(body, &data))
+	assert.Equal(t, "conformance-exp", data["name"])
+	assert.Equal(t, "productpage-v1", data["winner"])
+	assert.Equal(t, false, data["failed"])
+
+	// structured mode
+	structured := StructuredCloudEventMode
+	task.With.Mode = &structured
+	task.With.Type = tasks.StringPointer(ExperimentCompletedEventType)
+	task.With.Source = tasks.StringPointer("iter8/{{ .summary.name }}")
+	assert.NoError(t, task.Run(ctx))
+	assert.Equal(t, "application/cloudevents+json; charset=utf-8", header.Get("Content-Type"))
+	assert.Empty(t, header.Get("ce-type"))
+	event := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, CloudEventsSpecVersion, event["specversion"])
+	assert.Equal(t, ExperimentCompletedEventType, event["type"])
+	assert.Equal(t, "iter8/default/conformance-exp", event["source"])
+	assert.Equal(t, "application/json", event["datacontenttype"])
+	assert.Equal(t, "Completed", event["data"].(map[string]interface{})["stage"])
+}
@@ -0,0 +1,84 @@
+package notification
+
+import (
+	"context"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+)
+
+const (
+	// DiscordTaskName is the name of the task this file implements
+	DiscordTaskName string = "discord"
+
+	// discordGreen and discordRed are the colors of embeds for successful and failed experiments
+	discordGreen int = 0x2eb67d
+	discordRed   int = 0xe01e5a
+)
+
+// DiscordTaskInputs is the object corresponding to the expected inputs to the task
+type DiscordTaskInputs struct {
+	// name used to post the message; optional; default is the name of the webhook
+	Username      *string `json:"username,omitempty" yaml:"username,omitempty"`
+	WebhookInputs `json:",inline" yaml:",inline"`
+}
+
+// DiscordTask posts an embed summarizing the experiment to a Discord webhook.
+type DiscordTask struct {
+	tasks.TaskMeta `json:",inline" yaml:",inline"`
+	With           DiscordTaskInputs `json:"with" yaml:"with"`
+}
+
+// MakeDiscordTask converts a discord task spec into a DiscordTask.
+func MakeDiscordTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
+	task := &DiscordTask{}
+	if err := unmarshalTask(t, DiscordTaskName, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// Run the task. Ignores failures unless the task indicates ignoreFailure: false
+func (t *DiscordTask) Run(ctx context.Context) error {
+	return t.With.run(ctx, t.internalRun)
+}
+
+// Actual task runner
+func (t *DiscordTask) internalRun(ctx context.Context) error {
+	exp, err := tasks.GetExperimentFromContext(ctx)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	log.Trace("experiment", exp)
+	return postWebhook(t.With.Secret, t.DiscordMessage(exp))
+}
+
+// DiscordMessage constructs the Discord message, containing an embed, to post
+func (t *DiscordTask) DiscordMessage(e *tasks.Experiment) map[string]interface{} {
+	fields := []map[string]interface{}{}
+	for _, f := range Summary(e) {
+		fields = append(fields, map[string]interface{}{
+			"name":   f.Title,
+			"value":  f.Value,
+			"inline": true,
+		})
+	}
+	color := discordGreen
+	if Failed(e) {
+		color = discordRed
+	}
+
+	msg := map[string]interface{}{
+		"avatar_url": IconURL,
+		"embeds": []map[string]interface{}{{
+			"title":  Title(e),
+			"color":  color,
+			"fields": fields,
+		}},
+	}
+	if t.With.Username != nil {
+		msg["username"] = *t.With.Username
+	}
+	return msg
+}
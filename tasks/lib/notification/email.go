@@ -0,0 +1,335 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+)
+
+const (
+	// EmailTaskName is the name of the task this file implements
+	EmailTaskName string = "email"
+
+	// DefaultEmailSubject is the default template of the subject of emails
+	DefaultEmailSubject string = "Iter8 experiment {{ .summary.name }}: {{ .summary.stage }}"
+
+	// DefaultEmailText is the default template of the plain text body of emails
+	DefaultEmailText string = `{{ .summary.title }}
+
+Name: {{ .summary.name }}
+Versions: {{ .summary.versions }}
+Stage: {{ .summary.stage }}
+Winner: {{ .summary.winner }}
+{{- if .summary.failed }}
+Failed: true
+{{- end }}
+`
+
+	// DefaultEmailHTML is the default template of the HTML body of emails
+	DefaultEmailHTML string = `<html>
+<body>
+<h3>{{ .summary.title }}</h3>
+<table>
+<tr><th align="left">Name</th><td>{{ .summary.name }}</td></tr>
+<tr><th align="left">Versions</th><td>{{ .summary.versions }}</td></tr>
+<tr><th align="left">Stage</th><td>{{ .summary.stage }}</td></tr>
+<tr><th align="left">Winner</th><td>{{ .summary.winner }}</td></tr>
+{{- if .summary.failed }}
+<tr><th align="left">Failed</th><td>true</td></tr>
+{{- end }}
+</table>
+</body>
+</html>
+`
+)
+
+// SMTPSecurity is the type of transport security used to connect to an SMTP server
+type SMTPSecurity string
+
+const (
+	// NoSMTPSecurity connects without transport security
+	NoSMTPSecurity SMTPSecurity = "none"
+
+	// StartTLSSMTPSecurity upgrades the connection using STARTTLS
+	StartTLSSMTPSecurity SMTPSecurity = "starttls"
+
+	// TLSSMTPSecurity connects using implicit TLS
+	TLSSMTPSecurity SMTPSecurity = "tls"
+)
+
+// EmailTaskInputs is the object corresponding to the expected inputs to the task
+type EmailTaskInputs struct {
+	// host name of the SMTP server
+	Host string `json:"host" yaml:"host"`
+	// port of the SMTP server; optional; default 465 for tls and 587 otherwise
+	Port *int32 `json:"port,omitempty" yaml:"port,omitempty"`
+	// transport security; one of none, starttls and tls; optional; default starttls
+	Security *SMTPSecurity `json:"security,omitempty" yaml:"security,omitempty"`
+	// skip verification of the certificate of the SMTP server; optional; default false
+	InsecureSkipVerify *bool `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"`
+	// secret containing the username and password keys used to authenticate with the SMTP server; optional
+	Secret *string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	// sender address
+	From string `json:"from" yaml:"from"`
+	// recipient addresses
+	To []string `json:"to" yaml:"to"`
+	// carbon copy recipient addresses; optional
+	Cc []string `json:"cc,omitempty" yaml:"cc,omitempty"`
+	// template of the subject; optional
+	Subject *string `json:"subject,omitempty" yaml:"subject,omitempty"`
+	// template of the plain text body; optional
+	Text *string `json:"text,omitempty" yaml:"text,omitempty"`
+	// template of the HTML body; optional
+	HTML   *string `json:"html,omitempty" yaml:"html,omitempty"`
+	Inputs `json:",inline" yaml:",inline"`
+}
+
+// EmailTask sends an email summarizing the experiment over SMTP.
+// The subject and bodies are interpolated using the experiment (as this), the variables of the version
+// recommended for promotion, and a summary of the experiment (as summary).
+type EmailTask struct {
+	tasks.TaskMeta `json:",inline" yaml:",inline"`
+	With           EmailTaskInputs `json:"with" yaml:"with"`
+}
+
+// MakeEmailTask converts an email task spec into an EmailTask.
+func MakeEmailTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
+	task := &EmailTask{}
+	if err := unmarshalTask(t, EmailTaskName, task); err != nil {
+		return nil, err
+	}
+	if task.With.Host == "" || task.With.From == "" || len(task.With.To) == 0 {
+		return nil, errors.New("email task requires host, from and to")
+	}
+	if s := task.With.Security; s != nil && *s != NoSMTPSecurity && *s != StartTLSSMTPSecurity && *s != TLSSMTPSecurity {
+		return nil, fmt.Errorf("unknown security %s", *s)
+	}
+	return task, nil
+}
+
+// Run the task. Ignores failures unless the task indicates ignoreFailure: false
+func (t *EmailTask) Run(ctx context.Context) error {
+	return t.With.run(ctx, t.internalRun)
+}
+
+// Actual task runner
+func (t *EmailTask) internalRun(ctx context.Context) error {
+	exp, err := tasks.GetExperimentFromContext(ctx)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	log.Trace("experiment", exp)
+
+	msg, err := t.message(ctx, exp, time.Now())
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if err = t.send(msg); err != nil {
+		log.Error(err)
+	}
+	return err
+}
+
+// security returns the transport security used to connect to the SMTP server
+func (t *EmailTask) security() SMTPSecurity {
+	if t.With.Security != nil {
+		return *t.With.Security
+	}
+	return StartTLSSMTPSecurity
+}
+
+// message constructs the email to send, including its headers
+func (t *EmailTask) message(ctx context.Context, exp *tasks.Experiment, now time.Time) ([]byte, error) {
+	tags := tasks.ExperimentTags(ctx, exp).
+		With("summary", summaryObject(exp))
+
+	interpolate := func(template *string, defaultTemplate string) (string, error) {
+		if template == nil {
+			template = &defaultTemplate
+		}
+		return tags.Interpolate(template)
+	}
+	subject, err := interpolate(t.With.Subject, DefaultEmailSubject)
+	if err != nil {
+		return nil, err
+	}
+	text, err := interpolate(t.With.Text, DefaultEmailText)
+	if err != nil {
+		return nil, err
+	}
+	// values are HTML-escaped in the HTML body
+	htmlTags := tags.WithTemplateMode(tasks.HTMLTemplateMode)
+	htmlTemplate := DefaultEmailHTML
+	if t.With.HTML != nil {
+		htmlTemplate = *t.With.HTML
+	}
+	html, err := htmlTags.Interpolate(&htmlTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	w := multipart.NewWriter(buf)
+	header := []string{
+		"From: " + t.With.From,
+		"To: " + strings.Join(t.With.To, ", "),
+	}
+	if len(t.With.Cc) > 0 {
+		header = append(header, "Cc: "+strings.Join(t.With.Cc, ", "))
+	}
+	header = append(header,
+		"Subject: "+mime.QEncoding.Encode("utf-8", subject),
+		"Date: "+now.Format(time.RFC1123Z),
+		"Message-ID: "+messageID(t.With.From),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary="+w.Boundary(),
+	)
+	buf.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{contentType: "text/plain; charset=utf-8", content: text},
+		{contentType: "text/html; charset=utf-8", content: html},
+	} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err = qw.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err = qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// messageID generates a unique message ID in the domain of the sender
+func messageID(from string) string {
+	domain := "iter8.tools"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = strings.TrimSuffix(from[i+1:], ">")
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// smtpTimeout bounds the whole conversation with the SMTP server, so that an unresponsive server does not block the task
+var smtpTimeout = 30 * time.Second
+
+// send sends the email to all recipients through the SMTP server
+func (t *EmailTask) send(msg []byte) error {
+	security := t.security()
+	port := int32(587)
+	if security == TLSSMTPSecurity {
+		port = 465
+	}
+	if t.With.Port != nil {
+		port = *t.With.Port
+	}
+	addr := net.JoinHostPort(t.With.Host, strconv.Itoa(int(port)))
+	tlsConfig := &tls.Config{
+		ServerName:         t.With.Host,
+		InsecureSkipVerify: t.With.InsecureSkipVerify != nil && *t.With.InsecureSkipVerify,
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if security == TLSSMTPSecurity {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	// the deadline also applies to the TLS connection created by STARTTLS, which wraps conn
+	if err = conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, t.With.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if security == StartTLSSMTPSecurity {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if t.With.Secret != nil {
+		secret, err := tasks.GetSecret(*t.With.Secret)
+		if err != nil {
+			return err
+		}
+		auth := smtp.PlainAuth("", string(secret.Data["username"]), string(secret.Data["password"]), t.With.Host)
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(address(t.With.From)); err != nil {
+		return err
+	}
+	for _, rcpt := range append(append([]string{}, t.With.To...), t.With.Cc...) {
+		if err = c.Rcpt(address(rcpt)); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// address extracts the address from a string such as "Iter8 <iter8@example.com>"
+func address(s string) string {
+	if i := strings.LastIndex(s, "<"); i >= 0 {
+		return strings.TrimSuffix(s[i+1:], ">")
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,310 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// smtpStandIn is a minimal SMTP server that accepts a single email
+type smtpStandIn struct {
+	ln        net.Listener
+	tlsConfig *tls.Config
+	tls       bool
+	auth      string
+	from      string
+	rcpts     []string
+	data      []byte
+	done      chan struct{}
+}
+
+// newSMTPStandIn starts an SMTP stand-in; STARTTLS is offered if a TLS configuration is given,
+// unless TLS is implicit
+func newSMTPStandIn(t *testing.T, tlsConfig *tls.Config, implicit bool) *smtpStandIn {
+	var ln net.Listener
+	var err error
+	if implicit {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	assert.NoError(t, err)
+	s := &smtpStandIn{ln: ln, tlsConfig: tlsConfig, tls: implicit, done: make(chan struct{})}
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) port() int32 {
+	return int32(s.ln.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *smtpStandIn) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			tp.PrintfLine("250-localhost")
+			if s.tlsConfig != nil && !s.tls {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			s.tls = true
+		case "AUTH":
+			s.auth = line
+			tp.PrintfLine("235 accepted")
+		case "MAIL":
+			s.from = line
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.rcpts = append(s.rcpts, line)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			s.data, _ = tp.ReadDotBytes()
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// wait waits for the stand-in to finish serving, and closes it
+func (s *smtpStandIn) wait(t *testing.T) {
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+		t.Error("SMTP stand-in did not finish")
+	}
+	s.ln.Close()
+}
+
+// testTLSConfig returns a server TLS configuration with a self-signed certificate
+func testTLSConfig() *tls.Config {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	return &tls.Config{Certificates: srv.TLS.Certificates}
+}
+
+func TestMakeEmailTask(t *testing.T) {
+	with := func(s string) apiextensionsv1.JSON {
+		return apiextensionsv1.JSON{Raw: []byte(s)}
+	}
+	task, err := MakeTask(&v2alpha2.TaskSpec{
+		Task: LibraryName + "/" + EmailTaskName,
+		With: map[string]apiextensionsv1.JSON{
+			"host": with(`"smtp.example.com"`),
+			"from": with(`"iter8@example.com"`),
+			"to":   with(`["a@example.com", "b@example.com"]`),
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, StartTLSSMTPSecurity, task.(*EmailTask).security())
+
+	_, err = MakeTask(&v2alpha2.TaskSpec{
+		Task: LibraryName + "/" + EmailTaskName,
+		With: map[string]apiextensionsv1.JSON{
+			"host": with(`"smtp.example.com"`),
+			"from": with(`"iter8@example.com"`),
+		},
+	})
+	assert.Error(t, err)
+
+	_, err = MakeTask(&v2alpha2.TaskSpec{
+		Task: LibraryName + "/" + EmailTaskName,
+		With: map[string]apiextensionsv1.JSON{
+			"host":     with(`"smtp.example.com"`),
+			"from":     with(`"iter8@example.com"`),
+			"to":       with(`["a@example.com"]`),
+			"security": with(`"ssl"`),
+		},
+	})
+	assert.Error(t, err)
+}
+
+func TestEmailMessage(t *testing.T) {
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack1.yaml")).Build()
+	assert.NoError(t, err)
+
+	task := &EmailTask{With: EmailTaskInputs{
+		From: "Iter8 <iter8@example.com>",
+		To:   []string{"a@example.com", "b@example.com"},
+		Cc:   []string{"c@example.com"},
+	}}
+	msg, err := task.message(context.Background(), exp, time.Now())
+	assert.NoError(t, err)
+
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	assert.NoError(t, err)
+	assert.Equal(t, "Iter8 experiment default/conformance-exp: Completed", m.Header.Get("Subject"))
+	assert.Equal(t, "a@example.com, b@example.com", m.Header.Get("To"))
+	assert.Equal(t, "c@example.com", m.Header.Get("Cc"))
+	assert.Contains(t, m.Header.Get("Message-ID"), "@example.com>")
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+	r := multipart.NewReader(m.Body, params["boundary"])
+
+	part, err := r.NextPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", part.Header.Get("Content-Type"))
+	text, _ := ioutil.ReadAll(part)
+	assert.Contains(t, string(text), "Winner: productpage-v1")
+	assert.NotContains(t, string(text), "Failed")
+
+	part, err = r.NextPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "text/html; charset=utf-8", part.Header.Get("Content-Type"))
+	html, _ := ioutil.ReadAll(part)
+	assert.Contains(t, string(html), "<td>productpage-v1</td>")
+
+	task.With.Subject = tasks.StringPointer("{{ .summary.winner }} won")
+	msg, err = task.message(context.Background(), exp, time.Now())
+	assert.NoError(t, err)
+	m, err = mail.ReadMessage(bytes.NewReader(msg))
+	assert.NoError(t, err)
+	assert.Equal(t, "productpage-v1 won", m.Header.Get("Subject"))
+}
+
+func TestEmailSend(t *testing.T) {
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "smtp",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"username": []byte("iter8"),
+				"password": []byte("secret"),
+			},
+		}).Build(), nil
+	}
+
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack2.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+
+	for _, security := range []SMTPSecurity{NoSMTPSecurity, StartTLSSMTPSecurity, TLSSMTPSecurity} {
+		var tlsConfig *tls.Config
+		if security != NoSMTPSecurity {
+			tlsConfig = testTLSConfig()
+		}
+		s := newSMTPStandIn(t, tlsConfig, security == TLSSMTPSecurity)
+
+		sec := security
+		task := &EmailTask{With: EmailTaskInputs{
+			Host:               "127.0.0.1",
+			Port:               tasks.Int32Pointer(s.port()),
+			Security:           &sec,
+			InsecureSkipVerify: tasks.BoolPointer(true),
+			Secret:             tasks.StringPointer("default/smtp"),
+			From:               "iter8@example.com",
+			To:                 []string{"a@example.com", "Bee <b@example.com>"},
+			Cc:                 []string{"c@example.com"},
+			Inputs:             Inputs{IgnoreFailure: tasks.BoolPointer(false)},
+		}}
+		assert.NoError(t, task.Run(ctx), string(security))
+		s.wait(t)
+
+		assert.Equal(t, security != NoSMTPSecurity, s.tls, string(security))
+		assert.Equal(t, "AUTH PLAIN "+base64.StdEncoding.EncodeToString([]byte("\x00iter8\x00secret")), s.auth)
+		assert.Equal(t, "MAIL FROM:<iter8@example.com>", s.from)
+		assert.Equal(t, []string{"RCPT TO:<a@example.com>", "RCPT TO:<b@example.com>", "RCPT TO:<c@example.com>"}, s.rcpts)
+		assert.Contains(t, string(s.data), "Subject: Iter8 experiment default/quickstart-exp: Completed")
+	}
+}
+
+func TestEmailStartTLSRequired(t *testing.T) {
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack2.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+
+	s := newSMTPStandIn(t, nil, false)
+	defer s.ln.Close()
+	task := &EmailTask{With: EmailTaskInputs{
+		Host:   "127.0.0.1",
+		Port:   tasks.Int32Pointer(s.port()),
+		From:   "iter8@example.com",
+		To:     []string{"a@example.com"},
+		Inputs: Inputs{IgnoreFailure: tasks.BoolPointer(false)},
+	}}
+	err = task.Run(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "STARTTLS")
+}
+
+func TestEmailSendTimeout(t *testing.T) {
+	// the server accepts connections but never greets the client
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			<-time.After(10 * time.Second)
+			conn.Close()
+		}
+	}()
+
+	timeout := smtpTimeout
+	defer func() { smtpTimeout = timeout }()
+	smtpTimeout = 100 * time.Millisecond
+
+	sec := NoSMTPSecurity
+	task := &EmailTask{With: EmailTaskInputs{
+		Host:     "127.0.0.1",
+		Port:     tasks.Int32Pointer(int32(ln.Addr().(*net.TCPAddr).Port)),
+		Security: &sec,
+		From:     "iter8@example.com",
+		To:       []string{"a@example.com"},
+	}}
+	start := time.Now()
+	assert.Error(t, task.send([]byte("message")))
+	assert.Less(t, int64(time.Since(start)), int64(10*time.Second))
+}
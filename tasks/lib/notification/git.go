@@ -0,0 +1,244 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+)
+
+const (
+	// DefaultRepository is the default template of the repository; it is the value of the repository variable of the version
+	DefaultRepository string = "{{ .repository }}"
+	// DefaultSHA is the default template of the commit SHA; it is the value of the sha variable of the version
+	DefaultSHA string = "{{ .sha }}"
+	// DefaultPullRequest is the default template of the pull request number; it is the value of the pullRequest variable of the version
+	DefaultPullRequest string = "{{ .pullRequest }}"
+	// DefaultDeployment is the default template of the deployment ID; it is the value of the deployment variable of the version
+	DefaultDeployment string = "{{ .deployment }}"
+	// DefaultStatusContext is the default context (or name) of commit statuses and check runs
+	DefaultStatusContext string = "iter8"
+)
+
+// CommitStatusInputs contain the options of the commit status of a task that integrates with a Git hosting service
+type CommitStatusInputs struct {
+	// context (or name) distinguishing the status from those of other systems; optional; default iter8
+	Context *string `json:"context,omitempty" yaml:"context,omitempty"`
+	// template of the URL linked from the status; optional
+	TargetURL *string `json:"targetURL,omitempty" yaml:"targetURL,omitempty"`
+	// template of the description of the status; optional; default is the title and stage of the experiment
+	Description *string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// CommentInputs contain the options of the pull request comment of a task that integrates with a Git hosting service
+type CommentInputs struct {
+	// template of the body of the comment; optional; default is a markdown summary of the experiment
+	Body *string `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// DeploymentInputs contain the options of the deployment status of a task that integrates with a Git hosting service
+type DeploymentInputs struct {
+	// template of the ID of the deployment; optional; default {{ .deployment }}
+	ID *string `json:"id,omitempty" yaml:"id,omitempty"`
+	// template of the URL of the deployed environment; optional
+	EnvironmentURL *string `json:"environmentURL,omitempty" yaml:"environmentURL,omitempty"`
+	// template of the URL of the logs of the deployment; optional
+	LogURL *string `json:"logURL,omitempty" yaml:"logURL,omitempty"`
+}
+
+// GitInputs contain the inputs common to tasks that integrate with a Git hosting service.
+// The repository, commit SHA, pull request number and deployment ID are interpolated using the experiment (as this),
+// the variables of a version, and a summary of the experiment (as summary).
+type GitInputs struct {
+	// secret containing an access token under the key token, in the form namespace/name or name
+	Secret string `json:"secret" yaml:"secret"`
+	// base URL of the API; optional; default is the URL of the public service
+	APIURL *string `json:"apiURL,omitempty" yaml:"apiURL,omitempty"`
+	// version whose variables are used in templates; optional; default is the version recommended for promotion
+	Version *string `json:"version,omitempty" yaml:"version,omitempty"`
+	// template of the repository in the form owner/name; optional; default {{ .repository }}
+	Repository *string `json:"repository,omitempty" yaml:"repository,omitempty"`
+	// template of the commit SHA; optional; default {{ .sha }}
+	SHA *string `json:"sha,omitempty" yaml:"sha,omitempty"`
+	// template of the pull request number; optional; default {{ .pullRequest }}
+	PullRequest *string `json:"pullRequest,omitempty" yaml:"pullRequest,omitempty"`
+	// commit status to set; optional
+	Status *CommitStatusInputs `json:"status,omitempty" yaml:"status,omitempty"`
+	// pull request comment to post; optional
+	Comment *CommentInputs `json:"comment,omitempty" yaml:"comment,omitempty"`
+	// deployment status to set; optional
+	Deployment *DeploymentInputs `json:"deployment,omitempty" yaml:"deployment,omitempty"`
+	Inputs     `json:",inline" yaml:",inline"`
+}
+
+// MarkdownSummary returns a markdown summary of an experiment, suitable for pull request comments
+func MarkdownSummary(e *tasks.Experiment) string {
+	lines := []string{
+		"### " + Title(e),
+		"",
+		"| | |",
+		"|---|---|",
+	}
+	for _, f := range Summary(e) {
+		lines = append(lines, "| **"+f.Title+"** | "+f.Value+" |")
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// gitTags returns the tags used to interpolate the templates of a task that integrates with a Git hosting service
+func (in *GitInputs) gitTags(ctx context.Context, e *tasks.Experiment) *tasks.Tags {
+	tags := tasks.ExperimentTags(ctx, e)
+	if in.Version != nil {
+		tags = tags.WithVersion(&e.Experiment, *in.Version)
+	}
+	tags = tags.With("summary", summaryObject(e))
+	return &tags
+}
+
+// interpolate interpolates a template, or the default template if it is not set.
+// An error is returned if the result is empty, such as when a version has no variable used in the template.
+func interpolate(tags *tasks.Tags, template *string, defaultTemplate string, field string) (string, error) {
+	if template == nil {
+		template = &defaultTemplate
+	}
+	value, err := tags.Interpolate(template)
+	if err != nil {
+		return "", err
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", errors.New("no value for " + field)
+	}
+	return value, nil
+}
+
+// optional interpolates an optional template; the result is empty if the template is not set
+func optional(tags *tasks.Tags, template *string) (string, error) {
+	if template == nil {
+		return "", nil
+	}
+	return tags.Interpolate(template)
+}
+
+// description returns the description of the commit status of an experiment
+func (in *GitInputs) description(e *tasks.Experiment, tags *tasks.Tags) (string, error) {
+	if in.Status.Description != nil {
+		return tags.Interpolate(in.Status.Description)
+	}
+	description := Title(e) + ": " + Stage(e)
+	if Failed(e) {
+		description += " (failed)"
+	}
+	return description, nil
+}
+
+// statusContext returns the context of the commit status
+func (in *GitInputs) statusContext() string {
+	if in.Status != nil && in.Status.Context != nil {
+		return *in.Status.Context
+	}
+	return DefaultStatusContext
+}
+
+// comment returns the body of the pull request comment about an experiment
+func (in *GitInputs) comment(e *tasks.Experiment, tags *tasks.Tags) (string, error) {
+	if in.Comment.Body != nil {
+		return tags.Interpolate(in.Comment.Body)
+	}
+	return MarkdownSummary(e), nil
+}
+
+// completed returns true if the experiment has completed
+func completed(e *tasks.Experiment) bool {
+	return e.Status.Stage != nil && *e.Status.Stage == v2alpha2.ExperimentStageCompleted
+}
+
+// gitClient sends requests to the API of a Git hosting service
+type gitClient struct {
+	baseURL string
+	header  http.Header
+}
+
+// newGitClient creates a client whose requests are authenticated using the token in the named secret
+func newGitClient(baseURL string, secretName string, authHeader func(token string) (string, string)) (*gitClient, error) {
+	secret, err := tasks.GetSecret(secretName)
+	if err != nil {
+		return nil, err
+	}
+	token, ok := secret.Data["token"]
+	if !ok || len(token) == 0 {
+		return nil, errors.New("secret " + secretName + " does not contain key token")
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	name, value := authHeader(string(token))
+	header.Set(name, value)
+	return &gitClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		header:  header,
+	}, nil
+}
+
+// do sends a request with a JSON payload to the given path of the API
+func (c *gitClient) do(ctx context.Context, method string, path string, payload interface{}) error {
+	return c.doJSON(ctx, method, path, payload, nil)
+}
+
+// doJSON sends a request with a JSON payload, if any, to the given path of the API,
+// and decodes the JSON response into result, if any
+func (c *gitClient) doJSON(ctx context.Context, method string, path string, payload interface{}, result interface{}) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	log.Trace(method, " ", path, ": ", string(body))
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+
+	var httpClient = &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: tasks.TracedTransport(nil),
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, string(respBody))
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// validate checks that the inputs include a secret
+func (in *GitInputs) validate() error {
+	if in.Secret == "" {
+		return errors.New("task requires a secret")
+	}
+	return nil
+}
+
+// updates returns true if the inputs include a status, comment or deployment to update
+func (in *GitInputs) updates() bool {
+	return in.Status != nil || in.Comment != nil || in.Deployment != nil
+}
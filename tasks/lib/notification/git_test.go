@@ -0,0 +1,256 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// gitRequest is a request received by the stand-in for the API of a Git hosting service
+type gitRequest struct {
+	method  string
+	path    string
+	header  http.Header
+	payload map[string]interface{}
+}
+
+// gitServer starts a stand-in for the API of a Git hosting service, which records requests.
+// Comments that are posted are listed in response to GET requests.
+func gitServer(requests *[]gitRequest) *httptest.Server {
+	comments := []map[string]interface{}{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		*requests = append(*requests, gitRequest{
+			method:  r.Method,
+			path:    r.URL.EscapedPath(),
+			header:  r.Header,
+			payload: payload,
+		})
+		switch {
+		case r.Method == http.MethodGet:
+			json.NewEncoder(w).Encode(comments)
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/comments"):
+			comments = append(comments, map[string]interface{}{"id": len(comments) + 1, "body": payload["body"]})
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+}
+
+// gitContext returns a context with an experiment whose baseline version has Git variables,
+// and makes a token available in the secret default/git
+func gitContext(t *testing.T, file string) (context.Context, func()) {
+	getClient := tasks.GetClient
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "git",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"token": []byte("git-token"),
+			},
+		}).Build(), nil
+	}
+
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", file)).Build()
+	assert.NoError(t, err)
+	vd := &exp.Spec.VersionInfo.Baseline
+	vd.Variables = append(vd.Variables,
+		v2alpha2.NamedValue{Name: "repository", Value: "iter8-tools/bookinfo"},
+		v2alpha2.NamedValue{Name: "sha", Value: "c0ffee"},
+		v2alpha2.NamedValue{Name: "pullRequest", Value: "7"},
+		v2alpha2.NamedValue{Name: "deployment", Value: "42"},
+	)
+	return context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp), func() { tasks.GetClient = getClient }
+}
+
+func TestMakeGitTasks(t *testing.T) {
+	for _, task := range []string{GitHubTaskName, GitLabTaskName} {
+		_, err := MakeTask(&v2alpha2.TaskSpec{
+			Task: LibraryName + "/" + task,
+			With: map[string]apiextensionsv1.JSON{
+				"secret": {Raw: []byte(`"git"`)},
+				"status": {Raw: []byte(`{}`)},
+			},
+		})
+		assert.NoError(t, err)
+
+		_, err = MakeTask(&v2alpha2.TaskSpec{
+			Task: LibraryName + "/" + task,
+			With: map[string]apiextensionsv1.JSON{
+				"secret": {Raw: []byte(`"git"`)},
+			},
+		})
+		assert.Error(t, err)
+
+		_, err = MakeTask(&v2alpha2.TaskSpec{
+			Task: LibraryName + "/" + task,
+			With: map[string]apiextensionsv1.JSON{
+				"comment": {Raw: []byte(`{}`)},
+			},
+		})
+		assert.Error(t, err)
+	}
+}
+
+func TestMarkdownSummary(t *testing.T) {
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack3.yaml")).Build()
+	assert.NoError(t, err)
+	summary := MarkdownSummary(exp)
+	assert.Contains(t, summary, "### "+Title(exp)+"\n")
+	assert.Contains(t, summary, "| **Name** | "+Name(exp)+" |\n")
+	assert.Contains(t, summary, "| **Failed** | true |\n")
+}
+
+func TestGitHubTask(t *testing.T) {
+	requests := []gitRequest{}
+	srv := gitServer(&requests)
+	defer srv.Close()
+	ctx, reset := gitContext(t, "slack1.yaml")
+	defer reset()
+
+	task := &GitHubTask{With: GitHubTaskInputs{
+		CheckRun: &CheckRunInputs{DetailsURL: tasks.StringPointer("https://iter8.tools/{{ .this.metadata.name }}")},
+		GitInputs: GitInputs{
+			Secret:     "default/git",
+			APIURL:     tasks.StringPointer(srv.URL),
+			Status:     &CommitStatusInputs{Context: tasks.StringPointer("iter8/canary")},
+			Comment:    &CommentInputs{},
+			Deployment: &DeploymentInputs{},
+			Inputs:     Inputs{IgnoreFailure: tasks.BoolPointer(false)},
+		},
+	}}
+	assert.NoError(t, task.Run(ctx))
+	assert.Len(t, requests, 5)
+	for _, r := range requests {
+		assert.Equal(t, "Bearer git-token", r.header.Get("Authorization"))
+	}
+
+	assert.Equal(t, http.MethodPost, requests[0].method)
+	assert.Equal(t, "/repos/iter8-tools/bookinfo/statuses/c0ffee", requests[0].path)
+	assert.Equal(t, "success", requests[0].payload["state"])
+	assert.Equal(t, "iter8/canary", requests[0].payload["context"])
+
+	assert.Equal(t, http.MethodPost, requests[1].method)
+	assert.Equal(t, "/repos/iter8-tools/bookinfo/check-runs", requests[1].path)
+	assert.Equal(t, "c0ffee", requests[1].payload["head_sha"])
+	assert.Equal(t, "completed", requests[1].payload["status"])
+	assert.Equal(t, "success", requests[1].payload["conclusion"])
+	assert.Equal(t, "https://iter8.tools/conformance-exp", requests[1].payload["details_url"])
+
+	// the comment is posted since there is no earlier comment about the experiment
+	assert.Equal(t, http.MethodGet, requests[2].method)
+	assert.Equal(t, "/repos/iter8-tools/bookinfo/issues/7/comments", requests[2].path)
+	assert.Equal(t, http.MethodPost, requests[3].method)
+	assert.Equal(t, "/repos/iter8-tools/bookinfo/issues/7/comments", requests[3].path)
+	assert.Contains(t, requests[3].payload["body"], "| **Winner** | productpage-v1 |")
+	assert.Contains(t, requests[3].payload["body"], "<!-- iter8 experiment default/conformance-exp -->")
+
+	assert.Equal(t, http.MethodPost, requests[4].method)
+	assert.Equal(t, "/repos/iter8-tools/bookinfo/deployments/42/statuses", requests[4].path)
+	assert.Equal(t, "success", requests[4].payload["state"])
+
+	// the comment posted earlier is updated on later runs
+	requests = requests[:0]
+	task.With.Status, task.With.CheckRun, task.With.Deployment = nil, nil, nil
+	assert.NoError(t, task.Run(ctx))
+	assert.Len(t, requests, 2)
+	assert.Equal(t, http.MethodPatch, requests[1].method)
+	assert.Equal(t, "/repos/iter8-tools/bookinfo/issues/comments/1", requests[1].path)
+}
+
+func TestGitHubTaskEscapesPaths(t *testing.T) {
+	requests := []gitRequest{}
+	srv := gitServer(&requests)
+	defer srv.Close()
+	ctx, reset := gitContext(t, "slack1.yaml")
+	defer reset()
+
+	task := &GitHubTask{With: GitHubTaskInputs{
+		GitInputs: GitInputs{
+			Secret:     "default/git",
+			APIURL:     tasks.StringPointer(srv.URL),
+			Repository: tasks.StringPointer("iter8-tools/book info"),
+			SHA:        tasks.StringPointer("c0ffee?x"),
+			Status:     &CommitStatusInputs{},
+			Deployment: &DeploymentInputs{ID: tasks.StringPointer("../42")},
+			Inputs:     Inputs{IgnoreFailure: tasks.BoolPointer(false)},
+		},
+	}}
+	assert.NoError(t, task.Run(ctx))
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "/repos/iter8-tools/book%20info/statuses/c0ffee%3Fx", requests[0].path)
+	assert.Equal(t, "/repos/iter8-tools/book%20info/deployments/..%2F42/statuses", requests[1].path)
+}
+
+func TestGitHubTaskMissingVariable(t *testing.T) {
+	requests := []gitRequest{}
+	srv := gitServer(&requests)
+	defer srv.Close()
+	ctx, reset := gitContext(t, "slack1.yaml")
+	defer reset()
+
+	task := &GitHubTask{With: GitHubTaskInputs{
+		GitInputs: GitInputs{
+			Secret:     "default/git",
+			APIURL:     tasks.StringPointer(srv.URL),
+			Deployment: &DeploymentInputs{ID: tasks.StringPointer("{{ .deploymentID }}")},
+			Inputs:     Inputs{IgnoreFailure: tasks.BoolPointer(false)},
+		},
+	}}
+	assert.Error(t, task.Run(ctx))
+	assert.Empty(t, requests)
+}
+
+func TestGitLabTask(t *testing.T) {
+	requests := []gitRequest{}
+	srv := gitServer(&requests)
+	defer srv.Close()
+	ctx, reset := gitContext(t, "slack3.yaml")
+	defer reset()
+
+	task := &GitLabTask{With: GitLabTaskInputs{
+		GitInputs: GitInputs{
+			Secret:     "default/git",
+			APIURL:     tasks.StringPointer(srv.URL + "/api/v4"),
+			Version:    tasks.StringPointer("productpage-v1"),
+			Status:     &CommitStatusInputs{},
+			Comment:    &CommentInputs{Body: tasks.StringPointer("Experiment {{ .summary.name }} is {{ .summary.stage }}")},
+			Deployment: &DeploymentInputs{},
+			Inputs:     Inputs{IgnoreFailure: tasks.BoolPointer(false)},
+		},
+	}}
+	assert.NoError(t, task.Run(ctx))
+	assert.Len(t, requests, 3)
+	for _, r := range requests {
+		assert.Equal(t, "git-token", r.header.Get("PRIVATE-TOKEN"))
+	}
+
+	assert.Equal(t, http.MethodPost, requests[0].method)
+	assert.Equal(t, "/api/v4/projects/iter8-tools%2Fbookinfo/statuses/c0ffee", requests[0].path)
+	assert.Equal(t, "failed", requests[0].payload["state"])
+	assert.Equal(t, DefaultStatusContext, requests[0].payload["name"])
+
+	assert.Equal(t, "/api/v4/projects/iter8-tools%2Fbookinfo/merge_requests/7/notes", requests[1].path)
+	assert.Contains(t, requests[1].payload["body"], "Experiment default/")
+
+	assert.Equal(t, http.MethodPut, requests[2].method)
+	assert.Equal(t, "/api/v4/projects/iter8-tools%2Fbookinfo/deployments/42", requests[2].path)
+	assert.Equal(t, "failed", requests[2].payload["status"])
+}
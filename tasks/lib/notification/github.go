@@ -0,0 +1,260 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+)
+
+const (
+	// GitHubTaskName is the name of the task this file implements
+	GitHubTaskName string = "github"
+
+	// DefaultGitHubAPIURL is the default base URL of the GitHub API
+	DefaultGitHubAPIURL string = "https://api.github.com"
+
+	// gitHubCommentsPerPage is the number of pull request comments listed per request
+	gitHubCommentsPerPage int = 100
+)
+
+// CheckRunInputs contain the options of a GitHub check run
+type CheckRunInputs struct {
+	// name of the check run; optional; default iter8
+	Name *string `json:"name,omitempty" yaml:"name,omitempty"`
+	// template of the URL with details of the check run; optional
+	DetailsURL *string `json:"detailsURL,omitempty" yaml:"detailsURL,omitempty"`
+}
+
+// GitHubTaskInputs is the object corresponding to the expected inputs to the task
+type GitHubTaskInputs struct {
+	// check run to create; optional
+	CheckRun  *CheckRunInputs `json:"checkRun,omitempty" yaml:"checkRun,omitempty"`
+	GitInputs `json:",inline" yaml:",inline"`
+}
+
+// GitHubTask reports the state of the experiment to GitHub, as a commit status or check run,
+// a pull request comment, and a deployment status. The pull request comment is posted once,
+// and updated on later runs of the task.
+type GitHubTask struct {
+	tasks.TaskMeta `json:",inline" yaml:",inline"`
+	With           GitHubTaskInputs `json:"with" yaml:"with"`
+}
+
+// MakeGitHubTask converts a github task spec into a GitHubTask.
+func MakeGitHubTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
+	task := &GitHubTask{}
+	if err := unmarshalTask(t, GitHubTaskName, task); err != nil {
+		return nil, err
+	}
+	if err := task.With.validate(); err != nil {
+		return nil, err
+	}
+	if !task.With.updates() && task.With.CheckRun == nil {
+		return nil, errors.New("github task requires at least one of status, checkRun, comment and deployment")
+	}
+	return task, nil
+}
+
+// Run the task. Ignores failures unless the task indicates ignoreFailure: false
+func (t *GitHubTask) Run(ctx context.Context) error {
+	return t.With.run(ctx, t.internalRun)
+}
+
+// Actual task runner
+func (t *GitHubTask) internalRun(ctx context.Context) error {
+	exp, err := tasks.GetExperimentFromContext(ctx)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	tags := t.With.gitTags(ctx, exp)
+	repository, err := interpolate(tags, t.With.Repository, DefaultRepository, "repository")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	apiURL := DefaultGitHubAPIURL
+	if t.With.APIURL != nil {
+		apiURL = *t.With.APIURL
+	}
+	c, err := newGitClient(apiURL, t.With.Secret, func(token string) (string, string) {
+		return "Authorization", "Bearer " + token
+	})
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	c.header.Set("Accept", "application/vnd.github.v3+json")
+
+	for _, update := range []struct {
+		enabled bool
+		update  func(context.Context, *gitClient, *tasks.Experiment, *tasks.Tags, string) error
+	}{
+		{t.With.Status != nil, t.commitStatus},
+		{t.With.CheckRun != nil, t.checkRun},
+		{t.With.Comment != nil, t.comment},
+		{t.With.Deployment != nil, t.deploymentStatus},
+	} {
+		if !update.enabled {
+			continue
+		}
+		if err = update.update(ctx, c, exp, tags, gitHubRepository(repository)); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// gitHubRepository escapes the owner and name of a repository, in the form owner/name, for use in paths of the API
+func gitHubRepository(repository string) string {
+	parts := strings.Split(repository, "/")
+	for i := range parts {
+		parts[i] = url.PathEscape(parts[i])
+	}
+	return strings.Join(parts, "/")
+}
+
+// commentMarker identifies the comments about an experiment; it is hidden when the comment is rendered
+func commentMarker(e *tasks.Experiment) string {
+	return "<!-- iter8 experiment " + e.Namespace + "/" + e.Name + " -->"
+}
+
+// gitHubState returns the state of commit and deployment statuses about an experiment
+func gitHubState(e *tasks.Experiment) string {
+	if Failed(e) {
+		return "failure"
+	}
+	if completed(e) {
+		return "success"
+	}
+	return "pending"
+}
+
+// commitStatus sets the status of the commit
+func (t *GitHubTask) commitStatus(ctx context.Context, c *gitClient, e *tasks.Experiment, tags *tasks.Tags, repository string) error {
+	sha, err := interpolate(tags, t.With.SHA, DefaultSHA, "sha")
+	if err != nil {
+		return err
+	}
+	targetURL, err := optional(tags, t.With.Status.TargetURL)
+	if err != nil {
+		return err
+	}
+	description, err := t.With.description(e, tags)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "/repos/"+repository+"/statuses/"+url.PathEscape(sha), map[string]interface{}{
+		"state":       gitHubState(e),
+		"target_url":  targetURL,
+		"description": description,
+		"context":     t.With.statusContext(),
+	})
+}
+
+// checkRun creates a check run for the commit
+func (t *GitHubTask) checkRun(ctx context.Context, c *gitClient, e *tasks.Experiment, tags *tasks.Tags, repository string) error {
+	sha, err := interpolate(tags, t.With.SHA, DefaultSHA, "sha")
+	if err != nil {
+		return err
+	}
+	detailsURL, err := optional(tags, t.With.CheckRun.DetailsURL)
+	if err != nil {
+		return err
+	}
+	name := DefaultStatusContext
+	if t.With.CheckRun.Name != nil {
+		name = *t.With.CheckRun.Name
+	}
+	payload := map[string]interface{}{
+		"name":     name,
+		"head_sha": sha,
+		"status":   "in_progress",
+		"output": map[string]interface{}{
+			"title":   Title(e),
+			"summary": MarkdownSummary(e),
+		},
+	}
+	if detailsURL != "" {
+		payload["details_url"] = detailsURL
+	}
+	if Failed(e) || completed(e) {
+		payload["status"] = "completed"
+		payload["conclusion"] = gitHubState(e)
+	}
+	return c.do(ctx, http.MethodPost, "/repos/"+repository+"/check-runs", payload)
+}
+
+// comment posts a comment about the experiment on the pull request, or updates the comment posted earlier, if any.
+// Comments about the experiment are identified by a hidden marker in their body.
+func (t *GitHubTask) comment(ctx context.Context, c *gitClient, e *tasks.Experiment, tags *tasks.Tags, repository string) error {
+	pr, err := interpolate(tags, t.With.PullRequest, DefaultPullRequest, "pullRequest")
+	if err != nil {
+		return err
+	}
+	body, err := t.With.comment(e, tags)
+	if err != nil {
+		return err
+	}
+	marker := commentMarker(e)
+	payload := map[string]interface{}{
+		"body": body + "\n\n" + marker,
+	}
+
+	path := "/repos/" + repository + "/issues/" + url.PathEscape(pr) + "/comments"
+	for page := 1; ; page++ {
+		comments := []struct {
+			ID   int64  `json:"id"`
+			Body string `json:"body"`
+		}{}
+		if err = c.doJSON(ctx, http.MethodGet, fmt.Sprintf("%s?per_page=%d&page=%d", path, gitHubCommentsPerPage, page), nil, &comments); err != nil {
+			return err
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.Body, marker) {
+				return c.do(ctx, http.MethodPatch, "/repos/"+repository+"/issues/comments/"+strconv.FormatInt(comment.ID, 10), payload)
+			}
+		}
+		if len(comments) < gitHubCommentsPerPage {
+			break
+		}
+	}
+	return c.do(ctx, http.MethodPost, path, payload)
+}
+
+// deploymentStatus sets the status of the deployment
+func (t *GitHubTask) deploymentStatus(ctx context.Context, c *gitClient, e *tasks.Experiment, tags *tasks.Tags, repository string) error {
+	id, err := interpolate(tags, t.With.Deployment.ID, DefaultDeployment, "deployment")
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{
+		"description": Title(e) + ": " + Stage(e),
+	}
+	payload["state"] = gitHubState(e)
+	if payload["state"] == "pending" {
+		payload["state"] = "in_progress"
+	}
+	for key, template := range map[string]*string{
+		"environment_url": t.With.Deployment.EnvironmentURL,
+		"log_url":         t.With.Deployment.LogURL,
+	} {
+		value, err := optional(tags, template)
+		if err != nil {
+			return err
+		}
+		if value != "" {
+			payload[key] = value
+		}
+	}
+	return c.do(ctx, http.MethodPost, "/repos/"+repository+"/deployments/"+url.PathEscape(id)+"/statuses", payload)
+}
@@ -0,0 +1,160 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+)
+
+const (
+	// GitLabTaskName is the name of the task this file implements
+	GitLabTaskName string = "gitlab"
+
+	// DefaultGitLabAPIURL is the default base URL of the GitLab API
+	DefaultGitLabAPIURL string = "https://gitlab.com/api/v4"
+)
+
+// GitLabTaskInputs is the object corresponding to the expected inputs to the task.
+// The repository is the path of the GitLab project, such as group/project, and the pull request is the IID of a merge request.
+type GitLabTaskInputs struct {
+	GitInputs `json:",inline" yaml:",inline"`
+}
+
+// GitLabTask reports the state of the experiment to GitLab, as a commit status,
+// a merge request comment, and a deployment status.
+type GitLabTask struct {
+	tasks.TaskMeta `json:",inline" yaml:",inline"`
+	With           GitLabTaskInputs `json:"with" yaml:"with"`
+}
+
+// MakeGitLabTask converts a gitlab task spec into a GitLabTask.
+func MakeGitLabTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
+	task := &GitLabTask{}
+	if err := unmarshalTask(t, GitLabTaskName, task); err != nil {
+		return nil, err
+	}
+	if err := task.With.validate(); err != nil {
+		return nil, err
+	}
+	if !task.With.updates() {
+		return nil, errors.New("gitlab task requires at least one of status, comment and deployment")
+	}
+	return task, nil
+}
+
+// Run the task. Ignores failures unless the task indicates ignoreFailure: false
+func (t *GitLabTask) Run(ctx context.Context) error {
+	return t.With.run(ctx, t.internalRun)
+}
+
+// Actual task runner
+func (t *GitLabTask) internalRun(ctx context.Context) error {
+	exp, err := tasks.GetExperimentFromContext(ctx)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	tags := t.With.gitTags(ctx, exp)
+	repository, err := interpolate(tags, t.With.Repository, DefaultRepository, "repository")
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	project := "/projects/" + url.PathEscape(repository)
+
+	apiURL := DefaultGitLabAPIURL
+	if t.With.APIURL != nil {
+		apiURL = *t.With.APIURL
+	}
+	c, err := newGitClient(apiURL, t.With.Secret, func(token string) (string, string) {
+		return "PRIVATE-TOKEN", token
+	})
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	for _, update := range []struct {
+		enabled bool
+		update  func(context.Context, *gitClient, *tasks.Experiment, *tasks.Tags, string) error
+	}{
+		{t.With.Status != nil, t.commitStatus},
+		{t.With.Comment != nil, t.comment},
+		{t.With.Deployment != nil, t.deploymentStatus},
+	} {
+		if !update.enabled {
+			continue
+		}
+		if err = update.update(ctx, c, exp, tags, project); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// gitLabState returns the state of commit and deployment statuses about an experiment
+func gitLabState(e *tasks.Experiment) string {
+	if Failed(e) {
+		return "failed"
+	}
+	if completed(e) {
+		return "success"
+	}
+	return "running"
+}
+
+// commitStatus sets the status of the commit
+func (t *GitLabTask) commitStatus(ctx context.Context, c *gitClient, e *tasks.Experiment, tags *tasks.Tags, project string) error {
+	sha, err := interpolate(tags, t.With.SHA, DefaultSHA, "sha")
+	if err != nil {
+		return err
+	}
+	targetURL, err := optional(tags, t.With.Status.TargetURL)
+	if err != nil {
+		return err
+	}
+	description, err := t.With.description(e, tags)
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{
+		"state":       gitLabState(e),
+		"name":        t.With.statusContext(),
+		"description": description,
+	}
+	if targetURL != "" {
+		payload["target_url"] = targetURL
+	}
+	return c.do(ctx, http.MethodPost, project+"/statuses/"+sha, payload)
+}
+
+// comment posts a note on the merge request
+func (t *GitLabTask) comment(ctx context.Context, c *gitClient, e *tasks.Experiment, tags *tasks.Tags, project string) error {
+	mr, err := interpolate(tags, t.With.PullRequest, DefaultPullRequest, "pullRequest")
+	if err != nil {
+		return err
+	}
+	body, err := t.With.comment(e, tags)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, project+"/merge_requests/"+mr+"/notes", map[string]interface{}{
+		"body": body,
+	})
+}
+
+// deploymentStatus sets the status of the deployment
+func (t *GitLabTask) deploymentStatus(ctx context.Context, c *gitClient, e *tasks.Experiment, tags *tasks.Tags, project string) error {
+	id, err := interpolate(tags, t.With.Deployment.ID, DefaultDeployment, "deployment")
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPut, project+"/deployments/"+id, map[string]interface{}{
+		"status": gitLabState(e),
+	})
+}
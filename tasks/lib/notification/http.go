@@ -3,23 +3,51 @@ package notification
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/iter8-tools/etc3/api/v2alpha2"
 	"github.com/iter8-tools/handler/tasks"
+	"k8s.io/client-go/util/jsonpath"
 )
 
 const (
 	// HTTPTaskName is the name of the HTTP request task
 	HTTPTaskName string = "http"
+
+	// DefaultHTTPTimeout is the default timeout of each attempt to send the request
+	DefaultHTTPTimeout string = "5s"
+	// DefaultHTTPBackoff is the default duration before the first retry
+	DefaultHTTPBackoff string = "1s"
 )
 
+// HTTPTLS contains the TLS options used to send the request
+type HTTPTLS struct {
+	// secret containing the CA bundle used to verify the certificate of the server under the key ca.crt; optional
+	CASecret *string `json:"caSecret,omitempty" yaml:"caSecret,omitempty"`
+	// secret containing the client certificate and key used for mutual TLS under the keys tls.crt and tls.key; optional
+	CertSecret *string `json:"certSecret,omitempty" yaml:"certSecret,omitempty"`
+	// if true, the certificate of the server is not verified; optional; default false
+	InsecureSkipVerify *bool `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"`
+}
+
+// HTTPCapture captures a field of a JSON response into a version variable
+type HTTPCapture struct {
+	// name of the variable
+	Name string `json:"name" yaml:"name"`
+	// JSON path of the field in the response, such as .data.id
+	JSONPath string `json:"jsonPath" yaml:"jsonPath"`
+	// version in which the variable is set; optional; default is the version recommended for promotion
+	Version *string `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
 // HTTPInputs contain the name and arguments of the task.
 type HTTPInputs struct {
 	URL      string                `json:"URL" yaml:"URL"`
@@ -28,7 +56,26 @@ type HTTPInputs struct {
 	Secret   *string               `json:"secret,omitempty" yaml:"secret,omitempty"`
 	Headers  []v2alpha2.NamedValue `json:"headers,omitempty" yaml:"headers,omitempty"`
 	Body     *string               `json:"body,omitempty" yaml:"body,omitempty"`
-	Inputs   `json:",inline" yaml:",inline"`
+	// timeout of each attempt, such as 10s; optional; default 5s
+	Timeout *string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// number of retries after a connection error or a 5xx response; optional; default 0
+	NumRetries *int32 `json:"numRetries,omitempty" yaml:"numRetries,omitempty"`
+	// duration before the first retry, doubled before each subsequent retry; optional; default 1s
+	Backoff *string `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	// TLS options; optional
+	TLS *HTTPTLS `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// status codes of successful responses; optional; by default, any status code below 400 is successful
+	ExpectedStatusCodes []int `json:"expectedStatusCodes,omitempty" yaml:"expectedStatusCodes,omitempty"`
+	// fields of the response captured into version variables; optional
+	// as with tasks.UpdateVariable, a variable already present in the version is not overwritten
+	Capture []HTTPCapture `json:"capture,omitempty" yaml:"capture,omitempty"`
+	// options of OAuth2 authentication; required if authType is OAuth2
+	OAuth2 *OAuth2Inputs `json:"oauth2,omitempty" yaml:"oauth2,omitempty"`
+	// options of API key authentication; optional
+	APIKey *APIKeyInputs `json:"apiKey,omitempty" yaml:"apiKey,omitempty"`
+	// options of HMAC signing; optional
+	HMAC   *HMACInputs `json:"hmac,omitempty" yaml:"hmac,omitempty"`
+	Inputs `json:",inline" yaml:",inline"`
 }
 
 // HTTPTask encapsulates the task.
@@ -39,43 +86,63 @@ type HTTPTask struct {
 
 // MakeHTTPTask converts an spec to a task.
 func MakeHTTPTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
-	if t.Task != LibraryName+"/"+HTTPTaskName {
-		return nil, fmt.Errorf("library and task need to be '%s' and '%s'", LibraryName, HTTPTaskName)
+	ht := &HTTPTask{}
+	if err := unmarshalTask(t, HTTPTaskName, ht); err != nil {
+		return nil, err
 	}
-	var jsonBytes []byte
-	var task tasks.Task
-	// convert t to jsonBytes
-	jsonBytes, err := json.Marshal(t)
-	if err != nil {
+	if err := ht.validate(); err != nil {
 		return nil, err
 	}
-	// convert jsonString to ExecTask
-	task = &HTTPTask{}
-	err = json.Unmarshal(jsonBytes, &task)
-	return task, err
+	return ht, nil
+}
+
+// validate the inputs of the task
+func (t *HTTPTask) validate() error {
+	for _, d := range []*string{t.With.Timeout, t.With.Backoff} {
+		if d == nil {
+			continue
+		}
+		if _, err := time.ParseDuration(*d); err != nil {
+			return fmt.Errorf("invalid duration %s: %s", *d, err.Error())
+		}
+	}
+	if t.With.NumRetries != nil && *t.With.NumRetries < 0 {
+		return errors.New("numRetries cannot be negative")
+	}
+	if err := t.validateAuth(); err != nil {
+		return err
+	}
+	for _, c := range t.With.Capture {
+		if c.Name == "" {
+			return errors.New("capture requires a variable name")
+		}
+		if err := jsonpath.New(c.Name).Parse(tasks.JSONPathTemplate(c.JSONPath)); err != nil {
+			return fmt.Errorf("invalid json path for variable %s: %s", c.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// duration returns the given duration, or the default if it is not set
+func duration(d *string, defaultDuration string) time.Duration {
+	if d == nil {
+		d = &defaultDuration
+	}
+	dur, _ := time.ParseDuration(*d)
+	return dur
 }
 
 func (t *HTTPTask) prepareRequest(ctx context.Context) (*http.Request, error) {
-	tags := tasks.NewTags()
 	exp, err := tasks.GetExperimentFromContext(ctx)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
 
-	obj, err := exp.ToMap()
-	if err != nil {
-		// error already logged by ToMap()
-		// don't log it again
-		return nil, err
-	}
-
-	// prepare for interpolation; add experiment as tag
+	// prepare for interpolation using the data model common to all tasks
 	// Note that if versionRecommendedForPromotion is not set or there is no version corresponding to it,
 	// then some placeholders may not be replaced
-	tags = tags.
-		With("this", obj).
-		WithRecommendedVersionForPromotion(&exp.Experiment)
+	tags := tasks.ExperimentTags(ctx, exp)
 
 	// log tags now before secret is added; we don't log the secret
 	log.Trace("tags without secrets: ", tags)
@@ -84,7 +151,9 @@ func (t *HTTPTask) prepareRequest(ctx context.Context) (*http.Request, error) {
 	if secretName != nil {
 		secret, err := tasks.GetSecret(*secretName)
 		if err == nil {
-			tags = tags.WithSecret("secret", secret)
+			tags = tags.WithSecret("secret", secret).WithSecrets(secret)
+		} else {
+			log.Warn("unable to get secret ", *secretName, ": ", err)
 		}
 	}
 	log.Trace("tags with secrets: ", tags)
@@ -98,9 +167,11 @@ func (t *HTTPTask) prepareRequest(ctx context.Context) (*http.Request, error) {
 
 	body := t.With.Body
 	if body != nil {
-		if interpolated, err := tags.Interpolate(body); err == nil {
-			body = &interpolated
+		interpolated, err := tags.Interpolate(body)
+		if err != nil {
+			return nil, err
 		}
+		body = &interpolated
 	} else {
 		// body should be defaulted
 		b, err := defaultBody(exp.Experiment)
@@ -124,25 +195,40 @@ func (t *HTTPTask) prepareRequest(ctx context.Context) (*http.Request, error) {
 	}
 
 	req.Header.Set("Content-type", "application/json")
+	// headers and credentials that cannot be interpolated, such as those with missing keys in strict mode,
+	// fail the task before the request is sent
 	for _, h := range t.With.Headers {
 		hValue, err := tags.Interpolate(&h.Value)
 		if err != nil {
-			log.Warn("Unable to interpolate header "+h.Name, err)
-		} else {
-			req.Header.Set(h.Name, hValue)
+			return nil, fmt.Errorf("unable to interpolate header %s: %v", h.Name, err)
 		}
+		req.Header.Set(h.Name, hValue)
 	}
 
 	if *authType == v2alpha2.BasicAuthType {
 		usernameTemplate := "{{ .secret.username }}"
 		passwordTemplate := "{{ .secret.password }}"
-		username, _ := tags.Interpolate(&usernameTemplate)
-		password, _ := tags.Interpolate(&passwordTemplate)
+		username, err := tags.Interpolate(&usernameTemplate)
+		if err != nil {
+			return nil, err
+		}
+		password, err := tags.Interpolate(&passwordTemplate)
+		if err != nil {
+			return nil, err
+		}
 		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
 	} else if *authType == v2alpha2.BearerAuthType {
 		tokenTemplate := "{{ .secret.token }}"
-		token, _ := tags.Interpolate(&tokenTemplate)
+		token, err := tags.Interpolate(&tokenTemplate)
+		if err != nil {
+			return nil, err
+		}
 		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		secret, _ := tags.M["secret"].(map[string]interface{})
+		if err = t.authorize(req, secret, *body); err != nil {
+			return nil, err
+		}
 	}
 
 	return req, err
@@ -161,36 +247,43 @@ type experimentsummary struct {
 	LastRecommendedWeights         []v2alpha2.WeightData `json:"lastRecommendedWeights,omitempty" yaml:"lastRecommendedWeights,omitempty"`
 }
 
-func defaultBody(experiment v2alpha2.Experiment) (string, error) {
-	defaultBody := defaultbody{
-		Summary: experimentsummary{
-			WinnerFound: false,
-		},
-		Experiment: experiment,
+// newExperimentSummary summarizes the winner, version recommended for promotion and weights of an experiment
+func newExperimentSummary(experiment v2alpha2.Experiment) experimentsummary {
+	summary := experimentsummary{
+		WinnerFound: false,
 	}
 
 	// WinnerFound, Winner
 	if experiment.Status.Analysis != nil &&
 		experiment.Status.Analysis.WinnerAssessment != nil {
-		defaultBody.Summary.WinnerFound = experiment.Status.Analysis.WinnerAssessment.Data.WinnerFound
+		summary.WinnerFound = experiment.Status.Analysis.WinnerAssessment.Data.WinnerFound
 		if experiment.Status.Analysis.WinnerAssessment.Data.Winner != nil {
-			defaultBody.Summary.Winner = experiment.Status.Analysis.WinnerAssessment.Data.Winner
+			summary.Winner = experiment.Status.Analysis.WinnerAssessment.Data.Winner
 		}
 	}
 
 	// VersionRecommendedForPromotion
 	if experiment.Status.VersionRecommendedForPromotion != nil {
-		defaultBody.Summary.VersionRecommendedForPromotion = experiment.Status.VersionRecommendedForPromotion
+		summary.VersionRecommendedForPromotion = experiment.Status.VersionRecommendedForPromotion
 	}
 
 	// LastRecommendedWeights
 	if experiment.Status.Analysis != nil && experiment.Status.Analysis.Weights != nil {
-		defaultBody.Summary.LastRecommendedWeights = make([]v2alpha2.WeightData, len(experiment.Status.Analysis.Weights.Data))
+		summary.LastRecommendedWeights = make([]v2alpha2.WeightData, len(experiment.Status.Analysis.Weights.Data))
 		for i, w := range experiment.Status.Analysis.Weights.Data {
-			defaultBody.Summary.LastRecommendedWeights[i] = v2alpha2.WeightData{Name: w.Name, Value: w.Value}
+			summary.LastRecommendedWeights[i] = v2alpha2.WeightData{Name: w.Name, Value: w.Value}
 		}
 	}
 
+	return summary
+}
+
+func defaultBody(experiment v2alpha2.Experiment) (string, error) {
+	defaultBody := defaultbody{
+		Summary:    newExperimentSummary(experiment),
+		Experiment: experiment,
+	}
+
 	b, err := json.Marshal(defaultBody)
 	if err != nil {
 		return "", err
@@ -199,6 +292,144 @@ func defaultBody(experiment v2alpha2.Experiment) (string, error) {
 	return string(b), nil
 }
 
+// tlsConfig constructs the TLS configuration of the client from the TLS options and their secrets
+func (t *HTTPTask) tlsConfig() (*tls.Config, error) {
+	if t.With.TLS == nil {
+		return nil, nil
+	}
+	data, err := tasks.TLSData(t.With.TLS.CASecret, t.With.TLS.CertSecret)
+	if err != nil {
+		return nil, err
+	}
+	return tasks.TLSConfig(data, t.With.TLS.InsecureSkipVerify != nil && *t.With.TLS.InsecureSkipVerify)
+}
+
+// expected returns true if the status code indicates a successful response
+func (t *HTTPTask) expected(statusCode int) bool {
+	if len(t.With.ExpectedStatusCodes) == 0 {
+		return statusCode < 400
+	}
+	for _, code := range t.With.ExpectedStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends the request, retrying after connection errors and 5xx responses with exponential backoff.
+// The body of the final response is returned.
+func (t *HTTPTask) send(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	tlsConfig, err := t.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	var httpClient = &http.Client{
+		Timeout:   duration(t.With.Timeout, DefaultHTTPTimeout),
+		Transport: tasks.TracedTransport(nil),
+	}
+	if tlsConfig != nil {
+		// the default transport is cloned to keep its proxy, dial and idle connection timeouts, and HTTP/2 support
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		httpClient.Transport = tasks.TracedTransport(transport)
+	}
+
+	numRetries := int32(0)
+	if t.With.NumRetries != nil {
+		numRetries = *t.With.NumRetries
+	}
+	backoff := duration(t.With.Backoff, DefaultHTTPBackoff)
+
+	for attempt := int32(0); ; attempt++ {
+		r := req.Clone(ctx)
+		if req.GetBody != nil {
+			if r.Body, err = req.GetBody(); err != nil {
+				return nil, nil, err
+			}
+		}
+		var resp *http.Response
+		var body []byte
+		resp, err = httpClient.Do(r)
+		if err == nil {
+			body, err = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err == nil && resp.StatusCode < 500 {
+				return resp, body, nil
+			}
+			if err == nil {
+				err = fmt.Errorf("%s: %s", resp.Status, string(body))
+			}
+		}
+		if attempt >= numRetries {
+			return resp, body, err
+		}
+		log.Warn("attempt ", attempt+1, " failed: ", err, "; retrying in ", backoff)
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// capture sets version variables from fields of a JSON response, and updates the experiment in the cluster
+func (t *HTTPTask) capture(exp *tasks.Experiment, body []byte) error {
+	if len(t.With.Capture) == 0 {
+		return nil
+	}
+	var obj interface{}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return fmt.Errorf("cannot capture fields of response that is not JSON: %s", err.Error())
+	}
+	// captured values of variables of versions
+	type capturedVariable struct {
+		version string
+		name    string
+		value   string
+	}
+	captured := []capturedVariable{}
+	for _, c := range t.With.Capture {
+		version := ""
+		if c.Version != nil {
+			version = *c.Version
+		} else {
+			v, err := exp.GetVersionRecommendedForPromotion()
+			if err != nil {
+				return err
+			}
+			version = v
+		}
+		if _, err := exp.GetVersionDetail(version); err != nil {
+			return err
+		}
+		p := jsonpath.New(c.Name)
+		if err := p.Parse(tasks.JSONPathTemplate(c.JSONPath)); err != nil {
+			return err
+		}
+		buf := new(bytes.Buffer)
+		if err := p.Execute(buf, obj); err != nil {
+			return fmt.Errorf("cannot capture variable %s: %s", c.Name, err.Error())
+		}
+		log.Info("captured variable ", c.Name, " of version ", version)
+		captured = append(captured, capturedVariable{version: version, name: c.Name, value: buf.String()})
+	}
+	// only the captured variables are written, since etc3 may have changed the experiment
+	return tasks.UpdateInClusterExperiment(exp, func(e *tasks.Experiment) error {
+		for _, c := range captured {
+			vd, err := e.GetVersionDetail(c.version)
+			if err != nil {
+				return err
+			}
+			if err = tasks.UpdateVariable(vd, c.name, c.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // Run the command.
 func (t *HTTPTask) internalRun(ctx context.Context) error {
 	req, err := t.prepareRequest(ctx)
@@ -208,35 +439,33 @@ func (t *HTTPTask) internalRun(ctx context.Context) error {
 	}
 
 	// send request
-	var httpClient = &http.Client{
-		Timeout: time.Second * 5,
-	}
-
-	resp, err := httpClient.Do(req)
+	resp, body, err := t.send(ctx, req)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
 	log.Info("RESPONSE STATUS: " + resp.Status)
-	if resp.StatusCode >= 400 {
-
+	if !t.expected(resp.StatusCode) {
 		err = errors.New(resp.Status)
 		log.Error(err)
 		return err
 	}
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(resp.Body)
-	log.Info(buf.String())
+	// the body may be large or contain sensitive data, so it is only logged at trace level
+	log.Trace("response body: ", string(body))
 
+	exp, err := tasks.GetExperimentFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if err = t.capture(exp, body); err != nil {
+		log.Error(err)
+		return err
+	}
 	return nil
 }
 
-// Run the task. Ignores failures unless the task indicates ignoreFailures: false
+// Run the task. Ignores failures unless the task indicates ignoreFailure: false
 func (t *HTTPTask) Run(ctx context.Context) error {
-	err := t.internalRun(ctx)
-	if t.With.IgnoreFailure != nil && !*t.With.IgnoreFailure {
-		return err
-	}
-	return nil
+	return t.With.run(ctx, t.internalRun)
 }
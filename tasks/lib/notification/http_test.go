@@ -3,13 +3,20 @@ package notification
 import (
 	"context"
 	"encoding/json"
+	"encoding/pem"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/iter8-tools/etc3/api/v2alpha2"
 	"github.com/iter8-tools/handler/tasks"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestMakeFakeNotificationTask(t *testing.T) {
@@ -90,3 +97,141 @@ func TestMakeHttpTaskDefaults(t *testing.T) {
 	expectedBody := `{"summary":{"winnerFound":false,"versionRecommendedForPromotion":"default"},"experiment":{"kind":"Experiment","apiVersion":"iter8.tools/v2alpha2","metadata":{"name":"sklearn-iris-experiment-1","namespace":"default","selfLink":"/apis/iter8.tools/v2alpha2/namespaces/default/experiments/sklearn-iris-experiment-1","uid":"b99489b6-a1b4-420f-9615-165d6ff88293","generation":2,"creationTimestamp":"2020-12-27T21:55:48Z","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"apiVersion\":\"iter8.tools/v2alpha2\",\"kind\":\"Experiment\",\"metadata\":{\"annotations\":{},\"name\":\"sklearn-iris-experiment-1\",\"namespace\":\"default\"},\"spec\":{\"criteria\":{\"indicators\":[\"95th-percentile-tail-latency\"],\"objectives\":[{\"metric\":\"mean-latency\",\"upperLimit\":1000},{\"metric\":\"error-rate\",\"upperLimit\":\"0.01\"}]},\"duration\":{\"intervalSeconds\":15,\"iterationsPerLoop\":10},\"strategy\":{\"type\":\"Canary\"},\"target\":\"default/sklearn-iris\"}}\n"}},"spec":{"target":"default/sklearn-iris","versionInfo":{"baseline":{"name":"default","variables":[{"name":"revision","value":"revision1"}]},"candidates":[{"name":"canary","variables":[{"name":"revision","value":"revision2"}],"weightObjRef":{"kind":"InferenceService","namespace":"default","name":"sklearn-iris","apiVersion":"serving.kubeflow.org/v1alpha2","fieldPath":".spec.canaryTrafficPercent"}}]},"strategy":{"testingPattern":"Canary","deploymentPattern":"Progressive","actions":{"finish":[{"task":"common/exec","with":{"args":["build","."],"cmd":"kustomize"}}],"start":[{"task":"common/exec","with":{"args":["hello-world","hello {{ revision }} world","hello {{ omg }} world"],"cmd":"echo"}},{"task":"common/exec","with":{"args":["v1","v2",20,40.5],"cmd":"helm"}}]},"weights":{"maxCandidateWeight":100,"maxCandidateWeightIncrement":10}},"criteria":{"requestCount":"request-count","indicators":["95th-percentile-tail-latency"],"objectives":[{"metric":"mean-latency","upperLimit":"1k"},{"metric":"error-rate","upperLimit":"10m"}],"strength":null},"duration":{"intervalSeconds":15,"iterationsPerLoop":10}},"status":{"conditions":[{"type":"Completed","status":"False","lastTransitionTime":"2020-12-27T21:55:49Z","reason":"StartHandlerLaunched","message":"Start handler 'start' launched"},{"type":"Failed","status":"False","lastTransitionTime":"2020-12-27T21:55:48Z"}],"initTime":"2020-12-27T21:55:48Z","lastUpdateTime":"2020-12-27T21:55:48Z","completedIterations":0,"versionRecommendedForPromotion":"default","message":"StartHandlerLaunched: Start handler 'start' launched"}}}`
 	assert.Equal(t, expectedBody, string(data))
 }
+
+func TestMakeHttpTaskInvalid(t *testing.T) {
+	for _, with := range []map[string]apiextensionsv1.JSON{
+		{"URL": {Raw: []byte(`"http://target"`)}, "timeout": {Raw: []byte(`"five seconds"`)}},
+		{"URL": {Raw: []byte(`"http://target"`)}, "numRetries": {Raw: []byte(`-1`)}},
+		{"URL": {Raw: []byte(`"http://target"`)}, "capture": {Raw: []byte(`[{"name": "id", "jsonPath": ".data[?("}]`)}},
+	} {
+		_, err := MakeTask(&v2alpha2.TaskSpec{
+			Task: LibraryName + "/" + HTTPTaskName,
+			With: with,
+		})
+		assert.Error(t, err)
+	}
+}
+
+func TestHttpTaskRetryAndCapture(t *testing.T) {
+	// the server fails until it has failed the given number of times
+	attempts, failures := 0, 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := ioutil.ReadAll(r.Body)
+		if attempts <= failures || len(body) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"data": {"id": "deploy-42", "url": "http://dashboard/42"}}`))
+	}))
+	defer srv.Close()
+
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../../../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	c := slackClient(exp)
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return c, nil
+	}
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+
+	task := &HTTPTask{With: HTTPInputs{
+		URL:                 srv.URL,
+		NumRetries:          tasks.Int32Pointer(2),
+		Backoff:             tasks.StringPointer("10ms"),
+		ExpectedStatusCodes: []int{http.StatusAccepted},
+		Capture: []HTTPCapture{
+			{Name: "deployment", JSONPath: ".data.id"},
+			{Name: "dashboard", JSONPath: ".data.url", Version: tasks.StringPointer("canary")},
+		},
+		Inputs: Inputs{IgnoreFailure: tasks.BoolPointer(false)},
+	}}
+	assert.NoError(t, task.Run(ctx))
+	assert.Equal(t, 3, attempts)
+
+	updated := &tasks.Experiment{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(exp), updated))
+	value, err := tasks.FindVariableInVersionDetail(&updated.Spec.VersionInfo.Baseline, "deployment")
+	assert.NoError(t, err)
+	assert.Equal(t, "deploy-42", value)
+	value, err = tasks.FindVariableInVersionDetail(&updated.Spec.VersionInfo.Candidates[0], "dashboard")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://dashboard/42", value)
+
+	// retries are exhausted
+	attempts, failures = 0, 3
+	assert.Error(t, task.Run(ctx))
+	assert.Equal(t, 3, attempts)
+
+	// unexpected status code
+	attempts, failures = 0, 0
+	task.With.NumRetries = nil
+	task.With.ExpectedStatusCodes = []int{http.StatusOK}
+	assert.Error(t, task.Run(ctx))
+}
+
+func TestHttpTaskTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ca",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				corev1.ServiceAccountRootCAKey: caPEM,
+			},
+		}).Build(), nil
+	}
+
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../../../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+
+	task := &HTTPTask{With: HTTPInputs{
+		URL:    srv.URL,
+		Inputs: Inputs{IgnoreFailure: tasks.BoolPointer(false)},
+	}}
+	// certificate of the server is not trusted
+	assert.Error(t, task.Run(ctx))
+
+	task.With.TLS = &HTTPTLS{CASecret: tasks.StringPointer("default/ca")}
+	assert.NoError(t, task.Run(ctx))
+
+	task.With.TLS = &HTTPTLS{InsecureSkipVerify: tasks.BoolPointer(true)}
+	assert.NoError(t, task.Run(ctx))
+}
+
+func TestHttpTaskStrictTemplates(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../../../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+	tasks.SetStrictTemplates(true)
+	defer tasks.SetStrictTemplates(false)
+
+	// headers and credentials with missing keys fail the task before the request is sent
+	bearer := v2alpha2.BearerAuthType
+	for _, task := range []*HTTPTask{
+		{With: HTTPInputs{URL: srv.URL, Headers: []v2alpha2.NamedValue{{Name: "X-Missing", Value: "{{ .missing }}"}}}},
+		{With: HTTPInputs{URL: srv.URL, AuthType: &bearer}},
+	} {
+		task.With.IgnoreFailure = tasks.BoolPointer(false)
+		assert.Error(t, task.Run(ctx))
+	}
+	assert.Zero(t, requests)
+}
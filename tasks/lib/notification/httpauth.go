@@ -0,0 +1,245 @@
+package notification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+)
+
+const (
+	// OAuth2AuthType corresponds to authentication with an access token obtained using the OAuth2 client credentials grant
+	OAuth2AuthType v2alpha2.AuthType = "OAuth2"
+	// HMACAuthType corresponds to signing the body of the request with an HMAC
+	HMACAuthType v2alpha2.AuthType = "HMAC"
+
+	// HeaderAPIKeyLocation places the API key in a header
+	HeaderAPIKeyLocation string = "header"
+	// QueryAPIKeyLocation places the API key in a query parameter
+	QueryAPIKeyLocation string = "query"
+
+	// DefaultAPIKeyName is the default name of the header or query parameter containing the API key
+	DefaultAPIKeyName string = "X-API-Key"
+	// DefaultHMACHeader is the default header containing the HMAC signature of the body
+	DefaultHMACHeader string = "X-Hub-Signature-256"
+	// DefaultHMACPrefix is the default prefix of the HMAC signature of the body
+	DefaultHMACPrefix string = "sha256="
+)
+
+// OAuth2Inputs contain the options of the OAuth2 client credentials grant.
+// The client credentials are read from the keys client_id and client_secret of the secret of the task.
+type OAuth2Inputs struct {
+	// URL of the token endpoint
+	TokenURL string `json:"tokenURL" yaml:"tokenURL"`
+	// scopes requested; optional
+	Scopes []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+}
+
+// APIKeyInputs contain the options of API key authentication.
+// The API key is read from the key apiKey of the secret of the task. It is added to the request if these options are given,
+// or if the secret contains the key apiKey; otherwise, as before these options existed, the API key is expected in headers
+// interpolated using the secret, such as {{ .secret.token }}.
+type APIKeyInputs struct {
+	// name of the header or query parameter; optional; default X-API-Key
+	Name *string `json:"name,omitempty" yaml:"name,omitempty"`
+	// location of the API key; one of header and query; optional; default header
+	In *string `json:"in,omitempty" yaml:"in,omitempty"`
+}
+
+// HMACInputs contain the options of HMAC signing. The body is signed using HMAC-SHA256 with
+// the key read from the key hmacKey of the secret of the task, and the hex encoded signature is sent in a header.
+type HMACInputs struct {
+	// header containing the signature; optional; default X-Hub-Signature-256
+	Header *string `json:"header,omitempty" yaml:"header,omitempty"`
+	// prefix of the signature; optional; default sha256=
+	Prefix *string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+}
+
+// oauth2Token is an access token obtained from a token endpoint
+type oauth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	expiry      time.Time
+}
+
+// oauth2Tokens caches access tokens by token URL, client and scopes
+var oauth2Tokens = struct {
+	sync.Mutex
+	m map[string]oauth2Token
+}{m: map[string]oauth2Token{}}
+
+// validateAuth validates the options of the authentication type of the task
+func (t *HTTPTask) validateAuth() error {
+	if t.With.AuthType == nil {
+		return nil
+	}
+	switch *t.With.AuthType {
+	case OAuth2AuthType:
+		if t.With.OAuth2 == nil || t.With.OAuth2.TokenURL == "" {
+			return errors.New("OAuth2 authentication requires oauth2.tokenURL")
+		}
+	case v2alpha2.APIKeyAuthType:
+		if t.With.APIKey != nil && t.With.APIKey.In != nil &&
+			*t.With.APIKey.In != HeaderAPIKeyLocation && *t.With.APIKey.In != QueryAPIKeyLocation {
+			return fmt.Errorf("unknown API key location %s", *t.With.APIKey.In)
+		}
+	}
+	if t.With.Secret == nil {
+		switch *t.With.AuthType {
+		case OAuth2AuthType, HMACAuthType:
+			return fmt.Errorf("%s authentication requires a secret", *t.With.AuthType)
+		case v2alpha2.APIKeyAuthType:
+			// without apiKey options, the API key may be in interpolated headers, which need not use a secret
+			if t.With.APIKey != nil {
+				return fmt.Errorf("%s authentication with apiKey options requires a secret", *t.With.AuthType)
+			}
+		}
+	}
+	return nil
+}
+
+// secretValue returns the value of a key of a secret, as added to tags
+func secretValue(secret map[string]interface{}, key string) (string, error) {
+	if v, ok := secret[key].(string); ok && v != "" {
+		return v, nil
+	}
+	return "", errors.New("key " + key + " not found in secret")
+}
+
+// authorize adds credentials, obtained using the secret of the task, to the request with the given body
+func (t *HTTPTask) authorize(req *http.Request, secret map[string]interface{}, body string) error {
+	if t.With.AuthType == nil {
+		return nil
+	}
+	switch *t.With.AuthType {
+	case OAuth2AuthType:
+		token, err := t.oauth2Token(secret)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case v2alpha2.APIKeyAuthType:
+		if _, ok := secret["apiKey"]; !ok && t.With.APIKey == nil {
+			// the API key, if any, is in headers interpolated using the secret
+			return nil
+		}
+		key, err := secretValue(secret, "apiKey")
+		if err != nil {
+			return err
+		}
+		name, in := DefaultAPIKeyName, HeaderAPIKeyLocation
+		if t.With.APIKey != nil && t.With.APIKey.Name != nil {
+			name = *t.With.APIKey.Name
+		}
+		if t.With.APIKey != nil && t.With.APIKey.In != nil {
+			in = *t.With.APIKey.In
+		}
+		if in == QueryAPIKeyLocation {
+			q := req.URL.Query()
+			q.Set(name, key)
+			req.URL.RawQuery = q.Encode()
+		} else {
+			req.Header.Set(name, key)
+		}
+	case HMACAuthType:
+		key, err := secretValue(secret, "hmacKey")
+		if err != nil {
+			return err
+		}
+		header, prefix := DefaultHMACHeader, DefaultHMACPrefix
+		if t.With.HMAC != nil && t.With.HMAC.Header != nil {
+			header = *t.With.HMAC.Header
+		}
+		if t.With.HMAC != nil && t.With.HMAC.Prefix != nil {
+			prefix = *t.With.HMAC.Prefix
+		}
+		req.Header.Set(header, prefix+sign([]byte(key), []byte(body)))
+	}
+	return nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the body
+func sign(key []byte, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// oauth2Token returns an access token obtained using the client credentials grant.
+// Tokens are cached until shortly before they expire.
+func (t *HTTPTask) oauth2Token(secret map[string]interface{}) (string, error) {
+	clientID, err := secretValue(secret, "client_id")
+	if err != nil {
+		return "", err
+	}
+	clientSecret, err := secretValue(secret, "client_secret")
+	if err != nil {
+		return "", err
+	}
+	scope := strings.Join(t.With.OAuth2.Scopes, " ")
+	cacheKey := t.With.OAuth2.TokenURL + " " + clientID + " " + scope
+
+	oauth2Tokens.Lock()
+	defer oauth2Tokens.Unlock()
+	if token, ok := oauth2Tokens.m[cacheKey]; ok && time.Now().Before(token.expiry) {
+		log.Trace("using cached access token")
+		return token.AccessToken, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+	req, err := http.NewRequest(http.MethodPost, t.With.OAuth2.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString(
+		[]byte(url.QueryEscape(clientID)+":"+url.QueryEscape(clientSecret))))
+
+	var httpClient = &http.Client{
+		Timeout:   duration(t.With.Timeout, DefaultHTTPTimeout),
+		Transport: tasks.TracedTransport(nil),
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("token endpoint returned %s: %s", resp.Status, string(body))
+	}
+	token := oauth2Token{}
+	if err = json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("token endpoint returned no access token")
+	}
+	tasks.AddSensitiveValues(token.AccessToken)
+	if token.ExpiresIn > 0 {
+		// refresh tokens a little before they expire
+		token.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - 30*time.Second)
+		oauth2Tokens.m[cacheKey] = token
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,186 @@
+package notification
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// withAuthSecret makes the credentials of all auth schemes available in the secret default/auth
+func withAuthSecret(t *testing.T) func() {
+	getClient := tasks.GetClient
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "auth",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"client_id":     []byte("iter8"),
+				"client_secret": []byte("s3cr3t"),
+				"apiKey":        []byte("key-123"),
+				"hmacKey":       []byte("hmac-key"),
+			},
+		}).Build(), nil
+	}
+	return func() { tasks.GetClient = getClient }
+}
+
+func authContext(t *testing.T) context.Context {
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../../../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	return context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+}
+
+func TestMakeHttpTaskAuth(t *testing.T) {
+	for _, with := range []map[string]apiextensionsv1.JSON{
+		{"URL": {Raw: []byte(`"http://target"`)}, "authType": {Raw: []byte(`"OAuth2"`)}, "secret": {Raw: []byte(`"auth"`)}},
+		{"URL": {Raw: []byte(`"http://target"`)}, "authType": {Raw: []byte(`"HMAC"`)}},
+		{"URL": {Raw: []byte(`"http://target"`)}, "authType": {Raw: []byte(`"APIKey"`)}, "secret": {Raw: []byte(`"auth"`)}, "apiKey": {Raw: []byte(`{"in": "cookie"}`)}},
+	} {
+		_, err := MakeTask(&v2alpha2.TaskSpec{
+			Task: LibraryName + "/" + HTTPTaskName,
+			With: with,
+		})
+		assert.Error(t, err)
+	}
+}
+
+func TestHttpTaskOAuth2(t *testing.T) {
+	defer withAuthSecret(t)()
+	tokenRequests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			user, password, _ := r.BasicAuth()
+			r.ParseForm()
+			if user != "iter8" || password != "s3cr3t" || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "notify read" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token": "access-token", "token_type": "bearer", "expires_in": 3600}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	authType := OAuth2AuthType
+	task := &HTTPTask{With: HTTPInputs{
+		URL:      srv.URL + "/notify",
+		AuthType: &authType,
+		Secret:   tasks.StringPointer("default/auth"),
+		OAuth2:   &OAuth2Inputs{TokenURL: srv.URL + "/token", Scopes: []string{"notify", "read"}},
+		Inputs:   Inputs{IgnoreFailure: tasks.BoolPointer(false)},
+	}}
+	ctx := authContext(t)
+	assert.NoError(t, task.Run(ctx))
+	assert.NoError(t, task.Run(ctx))
+	// the token is cached
+	assert.Equal(t, 1, tokenRequests)
+}
+
+func TestHttpTaskAPIKey(t *testing.T) {
+	defer withAuthSecret(t)()
+	authType := v2alpha2.APIKeyAuthType
+	task := &HTTPTask{With: HTTPInputs{
+		URL:      "http://target/notify",
+		AuthType: &authType,
+		Secret:   tasks.StringPointer("default/auth"),
+	}}
+	ctx := authContext(t)
+
+	req, err := task.prepareRequest(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "key-123", req.Header.Get(DefaultAPIKeyName))
+
+	task.With.APIKey = &APIKeyInputs{Name: tasks.StringPointer("api_key"), In: tasks.StringPointer(QueryAPIKeyLocation)}
+	req, err = task.prepareRequest(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "key-123", req.URL.Query().Get("api_key"))
+	assert.Empty(t, req.Header.Get(DefaultAPIKeyName))
+}
+
+func TestHttpTaskAPIKeyInHeaders(t *testing.T) {
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "token",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"token": []byte("key-456"),
+			},
+		}).Build(), nil
+	}
+
+	// specs that put the API key in headers interpolated using a secret without the key apiKey remain valid
+	task, err := MakeTask(&v2alpha2.TaskSpec{
+		Task: LibraryName + "/" + HTTPTaskName,
+		With: map[string]apiextensionsv1.JSON{
+			"URL":      {Raw: []byte(`"http://target/notify"`)},
+			"authType": {Raw: []byte(`"APIKey"`)},
+			"secret":   {Raw: []byte(`"default/token"`)},
+			"headers":  {Raw: []byte(`[{"name": "X-Token", "value": "{{ .secret.token }}"}]`)},
+		},
+	})
+	assert.NoError(t, err)
+	req, err := task.(*HTTPTask).prepareRequest(authContext(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "key-456", req.Header.Get("X-Token"))
+	assert.Empty(t, req.Header.Get(DefaultAPIKeyName))
+
+	// as do specs without a secret
+	_, err = MakeTask(&v2alpha2.TaskSpec{
+		Task: LibraryName + "/" + HTTPTaskName,
+		With: map[string]apiextensionsv1.JSON{
+			"URL":      {Raw: []byte(`"http://target/notify"`)},
+			"authType": {Raw: []byte(`"APIKey"`)},
+			"headers":  {Raw: []byte(`[{"name": "X-Token", "value": "abc"}]`)},
+		},
+	})
+	assert.NoError(t, err)
+
+	// the key apiKey is required if apiKey options are given
+	task.(*HTTPTask).With.APIKey = &APIKeyInputs{}
+	_, err = task.(*HTTPTask).prepareRequest(authContext(t))
+	assert.Error(t, err)
+}
+
+func TestHttpTaskHMAC(t *testing.T) {
+	defer withAuthSecret(t)()
+	authType := HMACAuthType
+	task := &HTTPTask{With: HTTPInputs{
+		URL:      "http://target/notify",
+		AuthType: &authType,
+		Secret:   tasks.StringPointer("default/auth"),
+		Body:     tasks.StringPointer(`{"experiment": "{{ .this.metadata.name }}"}`),
+	}}
+	req, err := task.prepareRequest(authContext(t))
+	assert.NoError(t, err)
+
+	body, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, `{"experiment": "sklearn-iris-experiment-1"}`, string(body))
+	mac := hmac.New(sha256.New, []byte("hmac-key"))
+	mac.Write(body)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), req.Header.Get(DefaultHMACHeader))
+}
@@ -0,0 +1,89 @@
+package notification
+
+import (
+	"context"
+	"strings"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+)
+
+const (
+	// MattermostTaskName is the name of the task this file implements
+	MattermostTaskName string = "mattermost"
+)
+
+// MattermostTaskInputs is the object corresponding to the expected inputs to the task
+type MattermostTaskInputs struct {
+	// channel to post to; optional; default is the channel of the webhook
+	Channel *string `json:"channel,omitempty" yaml:"channel,omitempty"`
+	// name used to post the message; optional; default is the name of the webhook
+	Username      *string `json:"username,omitempty" yaml:"username,omitempty"`
+	WebhookInputs `json:",inline" yaml:",inline"`
+}
+
+// MattermostTask posts an attachment summarizing the experiment to a Mattermost incoming webhook.
+type MattermostTask struct {
+	tasks.TaskMeta `json:",inline" yaml:",inline"`
+	With           MattermostTaskInputs `json:"with" yaml:"with"`
+}
+
+// MakeMattermostTask converts a mattermost task spec into a MattermostTask.
+func MakeMattermostTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
+	task := &MattermostTask{}
+	if err := unmarshalTask(t, MattermostTaskName, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// Run the task. Ignores failures unless the task indicates ignoreFailure: false
+func (t *MattermostTask) Run(ctx context.Context) error {
+	return t.With.run(ctx, t.internalRun)
+}
+
+// Actual task runner
+func (t *MattermostTask) internalRun(ctx context.Context) error {
+	exp, err := tasks.GetExperimentFromContext(ctx)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	log.Trace("experiment", exp)
+	return postWebhook(t.With.Secret, t.MattermostMessage(exp))
+}
+
+// MattermostMessage constructs the Mattermost message, containing an attachment, to post
+func (t *MattermostTask) MattermostMessage(e *tasks.Experiment) map[string]interface{} {
+	fields := []map[string]interface{}{}
+	fallback := []string{Title(e)}
+	for _, f := range Summary(e) {
+		fields = append(fields, map[string]interface{}{
+			"title": f.Title,
+			"value": f.Value,
+			"short": true,
+		})
+		fallback = append(fallback, f.Title+": "+f.Value)
+	}
+	color := "#2eb67d"
+	if Failed(e) {
+		color = "#e01e5a"
+	}
+
+	msg := map[string]interface{}{
+		"icon_url": IconURL,
+		"attachments": []map[string]interface{}{{
+			"fallback": strings.Join(fallback, NewLine),
+			"color":    color,
+			"title":    Title(e),
+			"fields":   fields,
+		}},
+	}
+	if t.With.Channel != nil {
+		msg["channel"] = *t.With.Channel
+	}
+	if t.With.Username != nil {
+		msg["username"] = *t.With.Username
+	}
+	return msg
+}
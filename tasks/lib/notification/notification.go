@@ -1,7 +1,10 @@
 package notification
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/iter8-tools/etc3/api/v2alpha2"
 	"github.com/iter8-tools/handler/tasks"
@@ -26,6 +29,29 @@ type Inputs struct {
 	IgnoreFailure *bool `json:"ignoreFailure,omitempty" yaml:"ignoreFailure,omitempty"`
 }
 
+// run runs a task using the given runner. Ignores failures unless the task indicates ignoreFailure: false;
+// ignored failures are reported, and do not cause failure of the enclosing experiment.
+func (i *Inputs) run(ctx context.Context, internalRun func(context.Context) error) error {
+	err := internalRun(ctx)
+	if i.IgnoreFailure != nil && !*i.IgnoreFailure {
+		return err
+	}
+	tasks.ReportIgnoredFailure(ctx, err)
+	return nil
+}
+
+// unmarshalTask converts the spec of the named task of this library into the given task
+func unmarshalTask(t *v2alpha2.TaskSpec, name string, task tasks.Task) error {
+	if t.Task != LibraryName+"/"+name {
+		return fmt.Errorf("library and task need to be '%s' and '%s'", LibraryName, name)
+	}
+	jsonBytes, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonBytes, task)
+}
+
 // MakeTask constructs a Task from a TaskMeta or returns an error if any.
 func MakeTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
 	switch t.Task {
@@ -33,6 +59,20 @@ func MakeTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
 		return MakeSlackTask(t)
 	case LibraryName + "/" + HTTPTaskName:
 		return MakeHTTPTask(t)
+	case LibraryName + "/" + TeamsTaskName:
+		return MakeTeamsTask(t)
+	case LibraryName + "/" + DiscordTaskName:
+		return MakeDiscordTask(t)
+	case LibraryName + "/" + MattermostTaskName:
+		return MakeMattermostTask(t)
+	case LibraryName + "/" + EmailTaskName:
+		return MakeEmailTask(t)
+	case LibraryName + "/" + CloudEventTaskName:
+		return MakeCloudEventTask(t)
+	case LibraryName + "/" + GitHubTaskName:
+		return MakeGitHubTask(t)
+	case LibraryName + "/" + GitLabTaskName:
+		return MakeGitLabTask(t)
 	// add additional tasks here
 	default:
 		return nil, errors.New("Unknown task: " + t.Task)
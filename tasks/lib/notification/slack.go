@@ -5,26 +5,69 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/iter8-tools/etc3/api/v2alpha2"
 	"github.com/iter8-tools/handler/tasks"
 	"github.com/slack-go/slack"
-	"github.com/spf13/viper"
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/types"
 )
 
 const (
 	// SlackTaskName is the name of the task this file implements
 	SlackTaskName string = "slack"
+
+	// IconURL is the URL of the Iter8 icon used in chat notifications
+	IconURL string = "https://avatars.githubusercontent.com/u/53243580?s=200&v=4"
+
+	// SlackThreadsAnnotation is the experiment annotation that records, for each channel,
+	// the timestamp of the message whose thread later notifications reply to
+	SlackThreadsAnnotation string = "notification.iter8.tools/slack-threads"
+)
+
+// MentionCondition determines when mentions are included in a Slack message
+type MentionCondition string
+
+const (
+	// MentionOnFailure includes mentions only if the experiment has failed
+	MentionOnFailure MentionCondition = "failure"
+
+	// MentionAlways always includes mentions
+	MentionAlways MentionCondition = "always"
 )
 
+// slackAPIURL is the URL of the Slack API; it is a variable so that tests can use a fake Slack API
+var slackAPIURL = slack.APIURL
+
 // SlackTaskInputs is the object corresponding to the expcted inputs to the task
 type SlackTaskInputs struct {
+	// channel to post to; optional with incoming webhooks
 	Channel string `json:"channel" yaml:"channel"`
-	Secret  string `json:"secret" yaml:"secret"`
-	Inputs  `json:",inline" yaml:",inline"`
+	// secret containing either a bot token under the key token, or the URL of an incoming webhook under the key url
+	Secret string `json:"secret" yaml:"secret"`
+	// template of the title of the message; optional; default "<testing pattern> experiment on <target>"
+	Title *string `json:"title,omitempty" yaml:"title,omitempty"`
+	// template of the body of the message, in Slack markdown; optional; default is a summary of the experiment
+	Body *string `json:"body,omitempty" yaml:"body,omitempty"`
+	// template of a JSON array of Block Kit blocks that replaces the default layout; optional
+	Blocks *string `json:"blocks,omitempty" yaml:"blocks,omitempty"`
+	// URL of the icon of the message; optional; default is the Iter8 icon
+	IconURL *string `json:"iconURL,omitempty" yaml:"iconURL,omitempty"`
+	// emoji used as the icon of the message, such as :rocket:; optional; overrides iconURL
+	IconEmoji *string `json:"iconEmoji,omitempty" yaml:"iconEmoji,omitempty"`
+	// name used to post the message; optional
+	Username *string `json:"username,omitempty" yaml:"username,omitempty"`
+	// mentions, such as @here, @channel, user IDs (U...) and user group IDs (S...); optional
+	Mentions []string `json:"mentions,omitempty" yaml:"mentions,omitempty"`
+	// when mentions are included; one of failure and always; optional; default failure
+	MentionWhen *MentionCondition `json:"mentionWhen,omitempty" yaml:"mentionWhen,omitempty"`
+	// template of the URL of a dashboard of the experiment, linked from the default layout; optional
+	DashboardURL *string `json:"dashboardURL,omitempty" yaml:"dashboardURL,omitempty"`
+	// reply in the thread of the first message posted to the channel for this experiment; optional; default false
+	Thread *bool `json:"thread,omitempty" yaml:"thread,omitempty"`
+	Inputs `json:",inline" yaml:",inline"`
 }
 
 // SlackTask encapsulates a command that can be executed.
@@ -36,30 +79,16 @@ type SlackTask struct {
 
 // MakeSlackTask converts an sampletask spec into an base.Task.
 func MakeSlackTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
-	if t.Task != LibraryName+"/"+SlackTaskName {
-		return nil, fmt.Errorf("library and task need to be '%s' and '%s'", LibraryName, SlackTaskName)
-	}
-	var jsonBytes []byte
-	var task tasks.Task
-	// convert t to jsonBytes
-	jsonBytes, err := json.Marshal(t)
-	if err != nil {
+	task := &SlackTask{}
+	if err := unmarshalTask(t, SlackTaskName, task); err != nil {
 		return nil, err
 	}
-	// convert jsonString to SlackTask
-	task = &SlackTask{}
-	err = json.Unmarshal(jsonBytes, &task)
-	return task, err
+	return task, nil
 }
 
-// Run the task. This suppresses all errors so that the task will always succeed.
-// In this way, any failure does not cause failure of the enclosing experiment.
+// Run the task. Ignores failures unless the task indicates ignoreFailure: false
 func (t *SlackTask) Run(ctx context.Context) error {
-	err := t.internalRun(ctx)
-	if t.With.IgnoreFailure != nil && !*t.With.IgnoreFailure {
-		return err
-	}
-	return nil
+	return t.With.run(ctx, t.internalRun)
 }
 
 // Actual task runner
@@ -73,39 +102,215 @@ func (t *SlackTask) internalRun(ctx context.Context) error {
 		return err
 	}
 	log.Trace("experiment", exp)
-	return t.postNotification(exp)
+	return t.postNotification(ctx, exp)
 }
 
-func (t *SlackTask) postNotification(e *tasks.Experiment) error {
-	token := t.getToken()
-	if token == nil {
+func (t *SlackTask) postNotification(ctx context.Context, e *tasks.Experiment) error {
+	secret, err := tasks.GetSecret(t.With.Secret)
+	if err != nil {
+		log.Error(err)
 		return errors.New("Unable to find token")
 	}
-	log.Trace("token", t.getToken())
-	api := slack.New(*token)
-	channelID, timestamp, err := api.PostMessage(
-		t.With.Channel,
-		slack.MsgOptionBlocks(slack.NewSectionBlock(&slack.TextBlockObject{
+
+	msg, err := t.message(ctx, e)
+	if err != nil {
+		return err
+	}
+
+	// post to an incoming webhook if the secret contains its URL; replies in threads are not supported
+	// since incoming webhooks do not return the timestamp of the message
+	if _, ok := secret.Data[WebhookURLKey]; ok {
+		if t.With.Thread != nil && *t.With.Thread {
+			log.Warn("threads are not supported with incoming webhooks")
+		}
+		msg.Channel = t.With.Channel
+		// posted like other incoming webhooks, with a timeout and traced
+		return postWebhook(t.With.Secret, msg)
+	}
+
+	token, ok := secret.Data["token"]
+	if !ok {
+		return errors.New("Unable to find token")
+	}
+	options := []slack.MsgOption{
+		slack.MsgOptionText(msg.Text, false),
+		slack.MsgOptionBlocks(msg.Blocks.BlockSet...),
+	}
+	if len(msg.Attachments) > 0 {
+		options = append(options, slack.MsgOptionAttachments(msg.Attachments...))
+	}
+	if msg.IconEmoji != "" {
+		options = append(options, slack.MsgOptionIconEmoji(msg.IconEmoji))
+	} else {
+		options = append(options, slack.MsgOptionIconURL(msg.IconURL))
+	}
+	if msg.Username != "" {
+		options = append(options, slack.MsgOptionUsername(msg.Username))
+	}
+
+	// reply in the thread of an earlier message, if any
+	threads := map[string]string{}
+	if t.With.Thread != nil && *t.With.Thread {
+		if a, ok := e.Annotations[SlackThreadsAnnotation]; ok {
+			if err := json.Unmarshal([]byte(a), &threads); err != nil {
+				log.Warn("ignoring invalid annotation ", SlackThreadsAnnotation, ": ", err)
+				threads = map[string]string{}
+			}
+		}
+		if ts, ok := threads[t.With.Channel]; ok {
+			options = append(options, slack.MsgOptionTS(ts))
+		}
+	}
+
+	api := slack.New(string(token), slack.OptionAPIURL(slackAPIURL), slack.OptionHTTPClient(&http.Client{
+		Timeout:   time.Second * 10,
+		Transport: tasks.TracedTransport(nil),
+	}))
+	channelID, timestamp, err := api.PostMessage(t.With.Channel, options...)
+
+	log.Trace("channelID", channelID)
+	log.Trace("timestamp", timestamp)
+	if err != nil {
+		return err
+	}
+
+	// record the timestamp of the first message so that later notifications reply in its thread
+	if t.With.Thread != nil && *t.With.Thread {
+		if _, ok := threads[t.With.Channel]; !ok {
+			threads[t.With.Channel] = timestamp
+			a, err := json.Marshal(threads)
+			if err != nil {
+				return err
+			}
+			return tasks.UpdateInClusterExperiment(e, func(latest *tasks.Experiment) error {
+				if latest.Annotations == nil {
+					latest.Annotations = make(map[string]string)
+				}
+				latest.Annotations[SlackThreadsAnnotation] = string(a)
+				return nil
+			})
+		}
+	}
+	return nil
+}
+
+// message constructs the content of the Slack message to post
+func (t *SlackTask) message(ctx context.Context, e *tasks.Experiment) (*slack.WebhookMessage, error) {
+	tags := tasks.ExperimentTags(ctx, e).
+		With("summary", summaryObject(e))
+	var err error
+
+	title := Title(e)
+	if t.With.Title != nil {
+		if title, err = tags.Interpolate(t.With.Title); err != nil {
+			return nil, err
+		}
+	}
+	mentions := t.mentions(e)
+
+	// text is the fallback used in notifications
+	msg := &slack.WebhookMessage{
+		Text:    title,
+		IconURL: IconURL,
+		Blocks:  &slack.Blocks{},
+	}
+
+	if t.With.Blocks != nil {
+		b, err := tags.Interpolate(t.With.Blocks)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(b), msg.Blocks); err != nil {
+			return nil, errors.New("blocks are not a valid JSON array of Block Kit blocks: " + err.Error())
+		}
+		if len(mentions) > 0 {
+			msg.Blocks.BlockSet = append([]slack.Block{slack.NewSectionBlock(&slack.TextBlockObject{
+				Type: slack.MarkdownType,
+				Text: mentions,
+			}, nil, nil)}, msg.Blocks.BlockSet...)
+		}
+	} else {
+		body := SlackMessage(e)
+		if t.With.Body != nil {
+			if body, err = tags.Interpolate(t.With.Body); err != nil {
+				return nil, err
+			}
+		}
+		if t.With.DashboardURL != nil {
+			u, err := tags.Interpolate(t.With.DashboardURL)
+			if err != nil {
+				return nil, err
+			}
+			body += NewLine + Link(u, "View experiment")
+		}
+		header := Bold(title)
+		if len(mentions) > 0 {
+			header += Space + mentions
+		}
+		msg.Blocks.BlockSet = []slack.Block{slack.NewSectionBlock(&slack.TextBlockObject{
 			Type: slack.MarkdownType,
-			// Text: Bold(Name(e)),
-			Text: Bold(string(e.Spec.Strategy.TestingPattern) + " experiment on " + e.Spec.Target),
-		}, nil, nil)),
-		slack.MsgOptionAttachments(slack.Attachment{
+			Text: header,
+		}, nil, nil)}
+		msg.Attachments = []slack.Attachment{{
 			Blocks: slack.Blocks{
 				BlockSet: []slack.Block{
 					slack.NewSectionBlock(&slack.TextBlockObject{
 						Type: slack.MarkdownType,
-						Text: SlackMessage(e),
+						Text: body,
 					}, nil, nil),
 				},
 			},
-		}),
-		slack.MsgOptionIconURL("https://avatars.githubusercontent.com/u/53243580?s=200&v=4"),
-	)
+		}}
+	}
 
-	log.Trace("channelID", channelID)
-	log.Trace("timestamp", timestamp)
-	return err
+	if t.With.IconEmoji != nil {
+		msg.IconEmoji = *t.With.IconEmoji
+		msg.IconURL = ""
+	} else if t.With.IconURL != nil {
+		msg.IconURL = *t.With.IconURL
+	}
+	if t.With.Username != nil {
+		msg.Username = *t.With.Username
+	}
+	return msg, nil
+}
+
+// mentions returns the mentions to include in the message, formatted for Slack, if any
+func (t *SlackTask) mentions(e *tasks.Experiment) string {
+	when := MentionOnFailure
+	if t.With.MentionWhen != nil {
+		when = *t.With.MentionWhen
+	}
+	if when != MentionAlways && !Failed(e) {
+		return ""
+	}
+	mentions := []string{}
+	for _, m := range t.With.Mentions {
+		mentions = append(mentions, Mention(m))
+	}
+	return strings.Join(mentions, Space)
+}
+
+// userGroupID and userID match the IDs of Slack user groups and users
+var (
+	userGroupID = regexp.MustCompile(`^S[A-Z0-9]{8,}$`)
+	userID      = regexp.MustCompile(`^[UW][A-Z0-9]{8,}$`)
+)
+
+// Mention formats a mention for Slack. Special mentions (@here, @channel and @everyone),
+// user group IDs (such as S0614TZR7) and user IDs (such as U024BE7LH or W012A3CDE) are supported;
+// other mentions, such as names, are used as is.
+func Mention(m string) string {
+	switch {
+	case m == "@here" || m == "@channel" || m == "@everyone":
+		return "<!" + strings.TrimPrefix(m, "@") + ">"
+	case userGroupID.MatchString(m):
+		return "<!subteam^" + m + ">"
+	case userID.MatchString(m):
+		return "<@" + m + ">"
+	default:
+		return m
+	}
 }
 
 // SlackMessage constructs the slack message to post
@@ -119,6 +324,21 @@ func SlackMessage(e *tasks.Experiment) string {
 		Bold("Winner:") + Space + Italic(Winner(e)),
 	}
 
+	if e.Status.VersionRecommendedForPromotion != nil {
+		msg = append(msg, Bold("Version recommended for promotion:")+Space+Italic(*e.Status.VersionRecommendedForPromotion))
+	}
+	if weights := RecommendedWeights(e); weights != "" {
+		msg = append(msg, Bold("Recommended weights:")+Space+Italic(weights))
+	}
+	if objectives := Objectives(e); len(objectives) > 0 {
+		msg = append(msg, Bold("Objectives:"))
+		msg = append(msg, objectives...)
+	}
+	if indicators := Indicators(e); len(indicators) > 0 {
+		msg = append(msg, Bold("Indicators:"))
+		msg = append(msg, indicators...)
+	}
+
 	if Failed(e) {
 		msg = append(msg, Bold("Failed:")+Space+Italic("true"))
 	}
@@ -126,6 +346,11 @@ func SlackMessage(e *tasks.Experiment) string {
 	return strings.Join(msg, NewLine)
 }
 
+// Title returns the title of notifications about an experiment, in the form "<testing pattern> experiment on <target>"
+func Title(e *tasks.Experiment) string {
+	return string(e.Spec.Strategy.TestingPattern) + " experiment on " + e.Spec.Target
+}
+
 // Name returns the name of the experiment in the form namespace/name
 func Name(e *tasks.Experiment) string {
 	ns := e.Namespace
@@ -168,6 +393,93 @@ func Winner(e *tasks.Experiment) string {
 	return winner
 }
 
+// RecommendedWeights returns a comma separated list of the most recently recommended weight of each version, if any
+func RecommendedWeights(e *tasks.Experiment) string {
+	weights := []string{}
+	if e.Status.Analysis != nil && e.Status.Analysis.Weights != nil {
+		for _, w := range e.Status.Analysis.Weights.Data {
+			weights = append(weights, fmt.Sprintf("%s: %d", w.Name, w.Value))
+		}
+	}
+	return strings.Join(weights, ", ")
+}
+
+// versionNames returns the names of the versions of an experiment
+func versionNames(e *tasks.Experiment) []string {
+	names := []string{}
+	if e.Spec.VersionInfo != nil {
+		names = append(names, e.Spec.VersionInfo.Baseline.Name)
+		for _, c := range e.Spec.VersionInfo.Candidates {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// objective describes an objective, such as "mean-latency <= 100"
+func objective(o v2alpha2.Objective) string {
+	limits := []string{}
+	if o.LowerLimit != nil {
+		limits = append(limits, o.Metric+" >= "+o.LowerLimit.String())
+	}
+	if o.UpperLimit != nil {
+		limits = append(limits, o.Metric+" <= "+o.UpperLimit.String())
+	}
+	if len(limits) == 0 {
+		return o.Metric
+	}
+	return strings.Join(limits, " and ")
+}
+
+// Objectives returns, for each version, a line describing whether or not it satisfies each objective
+func Objectives(e *tasks.Experiment) []string {
+	if e.Spec.Criteria == nil || len(e.Spec.Criteria.Objectives) == 0 {
+		return nil
+	}
+	lines := []string{}
+	for _, v := range versionNames(e) {
+		var assessments v2alpha2.BooleanList
+		if e.Status.Analysis != nil && e.Status.Analysis.VersionAssessments != nil {
+			assessments = e.Status.Analysis.VersionAssessments.Data[v]
+		}
+		results := []string{}
+		for i, o := range e.Spec.Criteria.Objectives {
+			result := "not assessed"
+			if i < len(assessments) {
+				result = "satisfied"
+				if !assessments[i] {
+					result = "not satisfied"
+				}
+			}
+			results = append(results, objective(o)+": "+result)
+		}
+		lines = append(lines, "• "+v+": "+Italic(strings.Join(results, ", ")))
+	}
+	return lines
+}
+
+// Indicators returns, for each indicator, a line with its most recent value for each version
+func Indicators(e *tasks.Experiment) []string {
+	if e.Spec.Criteria == nil || len(e.Spec.Criteria.Indicators) == 0 {
+		return nil
+	}
+	lines := []string{}
+	for _, m := range e.Spec.Criteria.Indicators {
+		values := []string{}
+		for _, v := range versionNames(e) {
+			value := "unavailable"
+			if e.Status.Analysis != nil && e.Status.Analysis.AggregatedMetrics != nil {
+				if d, ok := e.Status.Analysis.AggregatedMetrics.Data[m].Data[v]; ok && d.Value != nil {
+					value = d.Value.String()
+				}
+			}
+			values = append(values, v+": "+value)
+		}
+		lines = append(lines, "• "+m+": "+Italic(strings.Join(values, ", ")))
+	}
+	return lines
+}
+
 // Failed returns true if the experiment has failed; false otherwise
 func Failed(e *tasks.Experiment) bool {
 	// use !.. IsFalse() to allow undefined value => true
@@ -179,6 +491,11 @@ func Bold(text string) string {
 	return "*" + text + "*"
 }
 
+// Link formats a link in Slack markdown
+func Link(url string, text string) string {
+	return "<" + url + "|" + text + ">"
+}
+
 // Italic formats a string as italic in markdown
 func Italic(text string) string {
 	return "_" + text + "_"
@@ -190,29 +507,3 @@ const (
 	// Space is a space character
 	Space string = " "
 )
-
-func (t *SlackTask) getToken() *string {
-	// get secret namespace and name
-	namespace := viper.GetViper().GetString("experiment_namespace")
-	var name string
-	secretNN := t.With.Secret
-	nn := strings.Split(secretNN, "/")
-	if len(nn) == 1 {
-		name = nn[0]
-	} else {
-		namespace = nn[0]
-		name = nn[1]
-	}
-	log.Trace("namespace", namespace)
-	log.Trace("name", name)
-
-	secret := corev1.Secret{}
-	err := tasks.GetTypedObject(&types.NamespacedName{Namespace: namespace, Name: name}, &secret)
-
-	if err != nil {
-		log.Error(err)
-		return nil
-	}
-	token := string(secret.Data["token"])
-	return &token
-}
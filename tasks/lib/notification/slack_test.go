@@ -1,14 +1,24 @@
 package notification
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"path/filepath"
 	"testing"
 
 	"github.com/iter8-tools/etc3/api/v2alpha2"
 	"github.com/iter8-tools/handler/tasks"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestMakeTask(t *testing.T) {
@@ -64,3 +74,173 @@ func TestExperiment(t *testing.T) {
 		}
 	}
 }
+
+// fakeSlack is a fake Slack API that records the form of each posted message
+func fakeSlack(posts *[]url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		*posts = append(*posts, r.PostForm)
+		fmt.Fprintf(w, `{"ok": true, "channel": "C1", "ts": "1625000000.%06d"}`, len(*posts))
+	}))
+}
+
+func TestSlackCustomMessage(t *testing.T) {
+	var posts []url.Values
+	srv := fakeSlack(&posts)
+	defer srv.Close()
+	defer func(u string) { slackAPIURL = u }(slackAPIURL)
+	slackAPIURL = srv.URL + "/"
+
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack2.yaml")).Build()
+	assert.NoError(t, err)
+	c := slackClient(exp)
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) { return c, nil }
+
+	always := MentionAlways
+	task := &SlackTask{With: SlackTaskInputs{
+		Channel:     "iter8",
+		Secret:      "default/slack-secret",
+		Title:       tasks.StringPointer("{{ .summary.name }} is {{ .summary.stage }}"),
+		Body:        tasks.StringPointer("winner: {{ .summary.winner }}"),
+		IconEmoji:   tasks.StringPointer(":rocket:"),
+		Username:    tasks.StringPointer("iter8-bot"),
+		Mentions:    []string{"@here", "S0614TZR7", "U024BE7LH"},
+		MentionWhen: &always,
+	}}
+	assert.NoError(t, task.postNotification(context.Background(), exp))
+	assert.Len(t, posts, 1)
+	assert.Equal(t, "default/quickstart-exp is Completed", posts[0].Get("text"))
+	assert.Equal(t, []string{"*default/quickstart-exp is Completed* <!here> <!subteam^S0614TZR7> <@U024BE7LH>"}, blockTexts(posts[0].Get("blocks")))
+	assert.Contains(t, posts[0].Get("attachments"), "winner: not found")
+	assert.Equal(t, ":rocket:", posts[0].Get("icon_emoji"))
+	assert.Equal(t, "iter8-bot", posts[0].Get("username"))
+
+	// mentions are only included on failure by default
+	task.With.MentionWhen = nil
+	task.With.Blocks = tasks.StringPointer(`[{"type": "section", "text": {"type": "mrkdwn", "text": "{{ .summary.versions }}"}}]`)
+	assert.NoError(t, task.postNotification(context.Background(), exp))
+	assert.Len(t, posts, 2)
+	assert.Equal(t, []string{"<!here> <!subteam^S0614TZR7> <@U024BE7LH>", "productpage-v1, productpage-v2"}, blockTexts(posts[1].Get("blocks")))
+	assert.Empty(t, posts[1].Get("attachments"))
+
+	succeeded, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack1.yaml")).Build()
+	assert.NoError(t, err)
+	assert.NoError(t, task.postNotification(context.Background(), succeeded))
+	assert.Equal(t, []string{"productpage-v1"}, blockTexts(posts[2].Get("blocks")))
+
+	task.With.Blocks = tasks.StringPointer(`{"type": "section"}`)
+	assert.Error(t, task.postNotification(context.Background(), exp))
+}
+
+func TestSlackThread(t *testing.T) {
+	var posts []url.Values
+	srv := fakeSlack(&posts)
+	defer srv.Close()
+	defer func(u string) { slackAPIURL = u }(slackAPIURL)
+	slackAPIURL = srv.URL + "/"
+
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack1.yaml")).Build()
+	assert.NoError(t, err)
+	c := slackClient(exp)
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) { return c, nil }
+
+	task := &SlackTask{With: SlackTaskInputs{
+		Channel: "iter8",
+		Secret:  "default/slack-secret",
+		Thread:  tasks.BoolPointer(true),
+	}}
+	assert.NoError(t, task.postNotification(context.Background(), exp))
+	assert.Empty(t, posts[0].Get("thread_ts"))
+
+	// the thread is recorded in the experiment in the cluster
+	updated := &tasks.Experiment{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(exp), updated))
+	assert.Equal(t, `{"iter8":"1625000000.000001"}`, updated.Annotations[SlackThreadsAnnotation])
+
+	assert.NoError(t, task.postNotification(context.Background(), updated))
+	assert.Equal(t, "1625000000.000001", posts[1].Get("thread_ts"))
+}
+
+// blockTexts returns the text of each section in a JSON array of blocks
+func blockTexts(blocks string) []string {
+	sections := []struct {
+		Text struct {
+			Text string `json:"text"`
+		} `json:"text"`
+	}{}
+	json.Unmarshal([]byte(blocks), &sections)
+	texts := []string{}
+	for _, s := range sections {
+		texts = append(texts, s.Text.Text)
+	}
+	return texts
+}
+
+// slackClient returns a fake client containing the experiment and a Slack token secret
+func slackClient(exp *tasks.Experiment) client.Client {
+	scheme := runtime.NewScheme()
+	metav1.AddToGroupVersion(scheme, v2alpha2.GroupVersion)
+	scheme.AddKnownTypes(v2alpha2.GroupVersion, &tasks.Experiment{})
+	corev1.AddToScheme(scheme)
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(exp, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "slack-secret",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			"token": []byte("xoxb-token"),
+		},
+	}).Build()
+}
+
+func TestSlackMessageDetails(t *testing.T) {
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack1.yaml")).Build()
+	assert.NoError(t, err)
+	exp.Spec.Criteria.Indicators = []string{"iter8-istio/request-count", "iter8-istio/throughput"}
+	exp.Status.Analysis.Weights.Data = []v2alpha2.WeightData{{Name: "productpage-v1", Value: 100}}
+
+	msg := SlackMessage(exp)
+	assert.Contains(t, msg, "*Version recommended for promotion:* _productpage-v1_\n")
+	assert.Contains(t, msg, "*Recommended weights:* _productpage-v1: 100_\n")
+	assert.Contains(t, msg, "*Objectives:*\n• productpage-v1: _iter8-istio/mean-latency <= 300: satisfied, iter8-istio/error-rate <= 10m: satisfied_\n")
+	assert.Contains(t, msg, "*Indicators:*\n• iter8-istio/request-count: _productpage-v1: 1537999399219n_\n• iter8-istio/throughput: _productpage-v1: unavailable_")
+
+	exp.Status.Analysis.VersionAssessments = nil
+	assert.Equal(t, []string{"• productpage-v1: _iter8-istio/mean-latency <= 300: not assessed, iter8-istio/error-rate <= 10m: not assessed_"}, Objectives(exp))
+}
+
+func TestSlackWebhook(t *testing.T) {
+	var payload map[string]interface{}
+	srv := webhookServer(&payload)
+	defer srv.Close()
+	defer withWebhookSecret(srv.URL)()
+
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack1.yaml")).Build()
+	assert.NoError(t, err)
+
+	task := &SlackTask{With: SlackTaskInputs{
+		Secret:       "default/webhook",
+		DashboardURL: tasks.StringPointer("https://grafana.example.com/d/iter8?var-experiment={{ .summary.name }}"),
+	}}
+	assert.NoError(t, task.postNotification(context.Background(), exp))
+	assert.Equal(t, Title(exp), payload["text"])
+	assert.Equal(t, IconURL, payload["icon_url"])
+	assert.NotContains(t, payload, "channel")
+	attachment, _ := json.Marshal(payload["attachments"])
+	assert.Contains(t, string(attachment), "\\u003chttps://grafana.example.com/d/iter8?var-experiment=default/conformance-exp|View experiment\\u003e")
+}
+
+func TestMention(t *testing.T) {
+	assert.Equal(t, "<!channel>", Mention("@channel"))
+	assert.Equal(t, "<!subteam^S0614TZR7>", Mention("S0614TZR7"))
+	assert.Equal(t, "<@U024BE7LH>", Mention("U024BE7LH"))
+	assert.Equal(t, "<@W012A3CDE>", Mention("W012A3CDE"))
+	// names that merely start with S, U or W are used as is
+	for _, m := range []string{"Sam", "Ursula", "Wendy", "SRE-team", "U123"} {
+		assert.Equal(t, m, Mention(m))
+	}
+}
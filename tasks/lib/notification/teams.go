@@ -0,0 +1,102 @@
+package notification
+
+import (
+	"context"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+)
+
+const (
+	// TeamsTaskName is the name of the task this file implements
+	TeamsTaskName string = "teams"
+)
+
+// TeamsTaskInputs is the object corresponding to the expected inputs to the task
+type TeamsTaskInputs struct {
+	WebhookInputs `json:",inline" yaml:",inline"`
+}
+
+// TeamsTask posts an Adaptive Card summarizing the experiment to a Microsoft Teams incoming webhook.
+type TeamsTask struct {
+	tasks.TaskMeta `json:",inline" yaml:",inline"`
+	With           TeamsTaskInputs `json:"with" yaml:"with"`
+}
+
+// MakeTeamsTask converts a teams task spec into a TeamsTask.
+func MakeTeamsTask(t *v2alpha2.TaskSpec) (tasks.Task, error) {
+	task := &TeamsTask{}
+	if err := unmarshalTask(t, TeamsTaskName, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// Run the task. Ignores failures unless the task indicates ignoreFailure: false
+func (t *TeamsTask) Run(ctx context.Context) error {
+	return t.With.run(ctx, t.internalRun)
+}
+
+// Actual task runner
+func (t *TeamsTask) internalRun(ctx context.Context) error {
+	exp, err := tasks.GetExperimentFromContext(ctx)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	log.Trace("experiment", exp)
+	return postWebhook(t.With.Secret, TeamsMessage(exp))
+}
+
+// TeamsMessage constructs the Teams message, containing an Adaptive Card, to post
+func TeamsMessage(e *tasks.Experiment) map[string]interface{} {
+	facts := []map[string]interface{}{}
+	for _, f := range Summary(e) {
+		facts = append(facts, map[string]interface{}{
+			"title": f.Title,
+			"value": f.Value,
+		})
+	}
+	color := "Good"
+	if Failed(e) {
+		color = "Attention"
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]interface{}{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.2",
+				"body": []map[string]interface{}{{
+					"type": "ColumnSet",
+					"columns": []map[string]interface{}{{
+						"type":  "Column",
+						"width": "auto",
+						"items": []map[string]interface{}{{
+							"type": "Image",
+							"url":  IconURL,
+							"size": "Small",
+						}},
+					}, {
+						"type":  "Column",
+						"width": "stretch",
+						"items": []map[string]interface{}{{
+							"type":   "TextBlock",
+							"text":   Title(e),
+							"size":   "Medium",
+							"weight": "Bolder",
+							"color":  color,
+							"wrap":   true,
+						}},
+					}},
+				}, {
+					"type":  "FactSet",
+					"facts": facts,
+				}},
+			},
+		}},
+	}
+}
@@ -0,0 +1,106 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/iter8-tools/handler/tasks"
+)
+
+// WebhookURLKey is the key of the webhook URL in the secret of a chat notification task
+const WebhookURLKey string = "url"
+
+// WebhookInputs contain the inputs common to tasks that post to an incoming webhook of a chat service
+type WebhookInputs struct {
+	// secret containing the URL of the incoming webhook under the key url, in the form namespace/name or name
+	Secret string `json:"secret" yaml:"secret"`
+	Inputs `json:",inline" yaml:",inline"`
+}
+
+// SummaryField is a titled value that summarizes an aspect of an experiment
+type SummaryField struct {
+	Title string
+	Value string
+}
+
+// Summary returns the fields that summarize an experiment in chat notifications
+func Summary(e *tasks.Experiment) []SummaryField {
+	fields := []SummaryField{
+		{Title: "Name", Value: Name(e)},
+		{Title: "Versions", Value: Versions(e)},
+		{Title: "Stage", Value: Stage(e)},
+		{Title: "Winner", Value: Winner(e)},
+	}
+	if Failed(e) {
+		fields = append(fields, SummaryField{Title: "Failed", Value: "true"})
+	}
+	return fields
+}
+
+// summaryObject returns a summary of an experiment for use in templates
+func summaryObject(e *tasks.Experiment) map[string]interface{} {
+	return map[string]interface{}{
+		"title":    Title(e),
+		"name":     Name(e),
+		"versions": Versions(e),
+		"stage":    Stage(e),
+		"winner":   Winner(e),
+		"failed":   Failed(e),
+	}
+}
+
+// webhookURL reads the URL of an incoming webhook from a secret
+func webhookURL(secretName string) (string, error) {
+	secret, err := tasks.GetSecret(secretName)
+	if err != nil {
+		return "", err
+	}
+	u, ok := secret.Data[WebhookURLKey]
+	if !ok || len(u) == 0 {
+		return "", errors.New("secret " + secretName + " does not contain key " + WebhookURLKey)
+	}
+	return string(u), nil
+}
+
+// postWebhook posts a JSON payload to the incoming webhook whose URL is in the named secret
+func postWebhook(secretName string, payload interface{}) error {
+	u, err := webhookURL(secretName)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	log.Trace("webhook payload: ", string(body))
+
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var httpClient = &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: tasks.TracedTransport(nil),
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("webhook returned %s: %s", resp.Status, string(respBody))
+		log.Error(err)
+		return err
+	}
+	return nil
+}
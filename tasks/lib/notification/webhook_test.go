@@ -0,0 +1,117 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// webhookServer records the JSON payload of the last request it receives
+func webhookServer(payload *map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, payload)
+	}))
+}
+
+// withWebhookSecret makes a secret named webhook, containing the given URL, available to tasks
+func withWebhookSecret(url string) func() {
+	getClient := tasks.GetClient
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "webhook",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				WebhookURLKey: []byte(url),
+			},
+		}).Build(), nil
+	}
+	return func() { tasks.GetClient = getClient }
+}
+
+func TestMakeWebhookTasks(t *testing.T) {
+	secret, _ := json.Marshal("default/webhook")
+	for _, name := range []string{TeamsTaskName, DiscordTaskName, MattermostTaskName} {
+		task, err := MakeTask(&v2alpha2.TaskSpec{
+			Task: LibraryName + "/" + name,
+			With: map[string]apiextensionsv1.JSON{
+				"secret": {Raw: secret},
+			},
+		})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, task)
+	}
+}
+
+func TestWebhookTasks(t *testing.T) {
+	var payload map[string]interface{}
+	srv := webhookServer(&payload)
+	defer srv.Close()
+	defer withWebhookSecret(srv.URL)()
+
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack1.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+
+	inputs := WebhookInputs{
+		Secret: "default/webhook",
+		Inputs: Inputs{IgnoreFailure: tasks.BoolPointer(false)},
+	}
+
+	teams := &TeamsTask{With: TeamsTaskInputs{WebhookInputs: inputs}}
+	assert.NoError(t, teams.Run(ctx))
+	assert.Equal(t, "message", payload["type"])
+	card := payload["attachments"].([]interface{})[0].(map[string]interface{})["content"].(map[string]interface{})
+	assert.Equal(t, "AdaptiveCard", card["type"])
+	facts := card["body"].([]interface{})[1].(map[string]interface{})["facts"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"title": "Name", "value": "default/conformance-exp"}, facts[0])
+	assert.Equal(t, map[string]interface{}{"title": "Winner", "value": "productpage-v1"}, facts[3])
+
+	discord := &DiscordTask{With: DiscordTaskInputs{Username: tasks.StringPointer("iter8"), WebhookInputs: inputs}}
+	assert.NoError(t, discord.Run(ctx))
+	assert.Equal(t, "iter8", payload["username"])
+	embed := payload["embeds"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, Title(exp), embed["title"])
+	assert.Equal(t, float64(discordGreen), embed["color"])
+	assert.Equal(t, "Versions", embed["fields"].([]interface{})[1].(map[string]interface{})["name"])
+
+	mattermost := &MattermostTask{With: MattermostTaskInputs{Channel: tasks.StringPointer("town-square"), WebhookInputs: inputs}}
+	assert.NoError(t, mattermost.Run(ctx))
+	assert.Equal(t, "town-square", payload["channel"])
+	attachment := payload["attachments"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, Title(exp), attachment["title"])
+	assert.Contains(t, attachment["fallback"], "Stage: Completed")
+}
+
+func TestWebhookFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	defer withWebhookSecret(srv.URL)()
+
+	exp, err := (&tasks.Builder{}).FromFile(filepath.Join("..", "..", "..", "testdata", "notification", "slack2.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+
+	teams := &TeamsTask{With: TeamsTaskInputs{WebhookInputs: WebhookInputs{Secret: "default/webhook"}}}
+	// failures are ignored by default
+	assert.NoError(t, teams.Run(ctx))
+	teams.With.IgnoreFailure = tasks.BoolPointer(false)
+	assert.Error(t, teams.Run(ctx))
+}
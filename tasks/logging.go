@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogFormat is the format of log output.
+type LogFormat string
+
+const (
+	// TextLogFormat formats each log entry as text
+	TextLogFormat LogFormat = "text"
+
+	// JSONLogFormat formats each log entry as a JSON object, for log pipelines
+	JSONLogFormat LogFormat = "json"
+)
+
+// Fields that identify the experiment, action, task and version to which a log entry relates
+const (
+	ExperimentLogField = "experiment"
+	NamespaceLogField  = "namespace"
+	ActionLogField     = "action"
+	TaskIndexLogField  = "taskIndex"
+	TaskLogField       = "task"
+	VersionLogField    = "version"
+)
+
+var logFormat = TextLogFormat
+
+// formatter returns the formatter of log entries in the given format
+func formatter(format LogFormat) logrus.Formatter {
+	if format == JSONLogFormat {
+		return &logrus.JSONFormatter{}
+	}
+	return &logrus.TextFormatter{
+		DisableQuote: true,
+	}
+}
+
+// SetLogFormat sets the format of log output.
+func SetLogFormat(format LogFormat) error {
+	if format != TextLogFormat && format != JSONLogFormat {
+		return fmt.Errorf("unknown log format %s", format)
+	}
+	logFormat = format
+	if log != nil {
+		log.SetFormatter(formatter(logFormat))
+	}
+	return nil
+}
+
+// logFields are added to every log entry
+var logFields = struct {
+	sync.RWMutex
+	fields logrus.Fields
+}{fields: logrus.Fields{}}
+
+// AddLogFields adds fields to every log entry, such as those identifying the running task.
+// Fields of an entry take precedence over these fields.
+func AddLogFields(fields logrus.Fields) {
+	logFields.Lock()
+	defer logFields.Unlock()
+	for k, v := range fields {
+		logFields.fields[k] = v
+	}
+}
+
+// RemoveLogFields removes fields added by AddLogFields.
+func RemoveLogFields(keys ...string) {
+	logFields.Lock()
+	defer logFields.Unlock()
+	for _, k := range keys {
+		delete(logFields.fields, k)
+	}
+}
+
+// fieldsHook adds the fields added by AddLogFields to log entries
+type fieldsHook struct{}
+
+// Levels returns the levels of log entries to which fields are added; all of them
+func (fieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire adds fields to a log entry
+func (fieldsHook) Fire(e *logrus.Entry) error {
+	logFields.RLock()
+	defer logFields.RUnlock()
+	for k, v := range logFields.fields {
+		if _, ok := e.Data[k]; !ok {
+			e.Data[k] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package tasks_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// logTask logs a message
+type logTask struct {
+	tasks.TaskMeta
+}
+
+func (t *logTask) Run(ctx context.Context) error {
+	tasks.GetLogger().WithField(tasks.VersionLogField, "canary").Info("hello")
+	return nil
+}
+
+func TestJSONLogFields(t *testing.T) {
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().Build(), nil
+	}
+
+	assert.Error(t, tasks.SetLogFormat("xml"))
+	assert.NoError(t, tasks.SetLogFormat(tasks.JSONLogFormat))
+	defer tasks.SetLogFormat(tasks.TextLogFormat)
+	log := tasks.GetLogger()
+	out := &bytes.Buffer{}
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+	ctx = context.WithValue(ctx, tasks.ContextKey("action"), "start")
+	action := tasks.Action{&logTask{TaskMeta: tasks.TaskMeta{Task: "common/bash"}}}
+	assert.NoError(t, action.Run(ctx))
+
+	var hello map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		entry := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		if entry["msg"] == "hello" {
+			hello = entry
+		}
+	}
+	assert.NotNil(t, hello)
+	assert.Equal(t, exp.Name, hello[tasks.ExperimentLogField])
+	assert.Equal(t, exp.Namespace, hello[tasks.NamespaceLogField])
+	assert.Equal(t, "start", hello[tasks.ActionLogField])
+	assert.Equal(t, float64(0), hello[tasks.TaskIndexLogField])
+	assert.Equal(t, "common/bash", hello[tasks.TaskLogField])
+	assert.Equal(t, "canary", hello[tasks.VersionLogField])
+
+	// fields are removed after the action
+	out.Reset()
+	log.Info("done")
+	assert.NotContains(t, out.String(), tasks.TaskLogField)
+}
@@ -0,0 +1,174 @@
+package tasks
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The data available to templates is the same in every task. It consists of:
+//
+//   .this        the experiment
+//   .versions    the variables of each version, by version name
+//   .baseline    the variables of the baseline version
+//   .candidates  the variables of each candidate version, by version name
+//   .recommended the variables of the version recommended for promotion, if any
+//   .winner      the variables of the winning version, if any
+//   .env         the environment variables of the handler
+//   .secrets     the data of secrets used by the task, by secret name
+//   .configMaps  the data of config maps referenced by the task, by config map name
+//   .task        the running task: its action, index, name, library and task
+//
+// The variables of a version include its name, as name. For compatibility with earlier templates,
+// the variables of the version recommended for promotion are also available at the top level,
+// unless they share a name with one of the above. Tasks may add data specific to them, such as .summary.
+
+// taskInfoKey is the context key of the running task
+const taskInfoKey ContextKey = "task"
+
+// TaskInfo describes the running task.
+type TaskInfo struct {
+	// Action is the name of the action
+	Action string
+	// Index is the index of the task in the action
+	Index int
+	// Name is the name of the task, including its library
+	Name string
+	// StrictTemplates overrides the default strict mode of interpolation, if set
+	StrictTemplates *bool
+	// data of the secrets and config maps referenced by the task, by object name
+	secrets    map[string]interface{}
+	configMaps map[string]interface{}
+}
+
+// WithTaskInfo returns a copy of the given context with the running task.
+func WithTaskInfo(ctx context.Context, ti *TaskInfo) context.Context {
+	return context.WithValue(ctx, taskInfoKey, ti)
+}
+
+// GetTaskInfoFromContext gets the running task from given context; nil if there is none.
+func GetTaskInfoFromContext(ctx context.Context) *TaskInfo {
+	if ti, ok := ctx.Value(taskInfoKey).(*TaskInfo); ok {
+		return ti
+	}
+	return nil
+}
+
+// versionData returns the variables of a version, including its name
+func versionData(vd *v2alpha2.VersionDetail) map[string]interface{} {
+	data := map[string]interface{}{"name": vd.Name}
+	for _, v := range vd.Variables {
+		data[v.Name] = v.Value
+	}
+	return data
+}
+
+// taskData returns the running task as data for templates
+func taskData(ti *TaskInfo) map[string]interface{} {
+	data := map[string]interface{}{}
+	if ti == nil {
+		return data
+	}
+	data["action"] = ti.Action
+	data["index"] = ti.Index
+	data["name"] = ti.Name
+	if i := strings.Index(ti.Name, "/"); i >= 0 {
+		data["library"] = ti.Name[:i]
+		data["task"] = ti.Name[i+1:]
+	} else {
+		data["task"] = ti.Name
+	}
+	return data
+}
+
+// envData returns the environment variables as data for templates
+func envData() map[string]interface{} {
+	data := map[string]interface{}{}
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			data[kv[:i]] = kv[i+1:]
+		}
+	}
+	return data
+}
+
+// ExperimentTags creates the tags of the data model available to templates, from the given experiment
+// and the running task in the given context.
+func ExperimentTags(ctx context.Context, exp *Experiment) Tags {
+	tags := NewTags()
+	versions := map[string]interface{}{}
+	candidates := map[string]interface{}{}
+	if exp != nil {
+		tags = tags.WithRecommendedVersionForPromotion(&exp.Experiment)
+		if obj, err := exp.ToMap(); err == nil {
+			tags = tags.With("this", obj)
+		}
+
+		if vi := exp.Spec.VersionInfo; vi != nil {
+			baseline := versionData(&vi.Baseline)
+			versions[vi.Baseline.Name] = baseline
+			tags = tags.With("baseline", baseline)
+			for i := range vi.Candidates {
+				candidate := versionData(&vi.Candidates[i])
+				versions[vi.Candidates[i].Name] = candidate
+				candidates[vi.Candidates[i].Name] = candidate
+			}
+		}
+		if r := exp.Status.VersionRecommendedForPromotion; r != nil {
+			if v, ok := versions[*r]; ok {
+				tags = tags.With("recommended", v)
+			}
+		}
+		if a := exp.Status.Analysis; a != nil && a.WinnerAssessment != nil && a.WinnerAssessment.Data.WinnerFound &&
+			a.WinnerAssessment.Data.Winner != nil {
+			if v, ok := versions[*a.WinnerAssessment.Data.Winner]; ok {
+				tags = tags.With("winner", v)
+			}
+		}
+	}
+	secrets := map[string]interface{}{}
+	configMaps := map[string]interface{}{}
+	ti := GetTaskInfoFromContext(ctx)
+	if ti != nil {
+		if ti.StrictTemplates != nil {
+			tags = tags.WithStrict(*ti.StrictTemplates)
+		}
+		for n, v := range ti.secrets {
+			secrets[n] = v
+		}
+		for n, v := range ti.configMaps {
+			configMaps[n] = v
+		}
+	}
+	return tags.
+		With("versions", versions).
+		With("candidates", candidates).
+		With("env", envData()).
+		With("secrets", secrets).
+		With("configMaps", configMaps).
+		With("task", taskData(ti))
+}
+
+// WithSecrets adds the data of secrets to .secrets, by secret name; their values are redacted from log output
+func (tags Tags) WithSecrets(secrets ...*corev1.Secret) Tags {
+	s, ok := tags.M["secrets"].(map[string]interface{})
+	if !ok {
+		s = map[string]interface{}{}
+		tags.M["secrets"] = s
+	}
+	for _, secret := range secrets {
+		if secret == nil {
+			continue
+		}
+		obj := make(map[string]interface{})
+		for n, v := range secret.Data {
+			obj[n] = string(v)
+			AddSensitiveValues(string(v))
+		}
+		s[secret.Name] = obj
+	}
+	return tags
+}
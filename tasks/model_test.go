@@ -0,0 +1,183 @@
+package tasks_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/iter8-tools/etc3/api/v2alpha2"
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// templateTask interpolates a template using the data model, and records the result
+type templateTask struct {
+	tasks.TaskMeta
+	template string
+	result   string
+}
+
+func (t *templateTask) Run(ctx context.Context) error {
+	exp, err := tasks.GetExperimentFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tags := tasks.ExperimentTags(ctx, exp)
+	t.result, err = tags.Interpolate(&t.template)
+	return err
+}
+
+func TestExperimentTags(t *testing.T) {
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	exp.Status.Analysis = &v2alpha2.Analysis{
+		WinnerAssessment: &v2alpha2.WinnerAssessmentAnalysis{
+			Data: v2alpha2.WinnerAssessmentData{
+				WinnerFound: true,
+				Winner:      tasks.StringPointer("canary"),
+			},
+		},
+	}
+	os.Setenv("ITER8_MODEL_TEST", "env-value")
+	defer os.Unsetenv("ITER8_MODEL_TEST")
+
+	tags := tasks.ExperimentTags(context.Background(), exp).WithSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "creds"},
+		Data:       map[string][]byte{"token": []byte("t0ken")},
+	})
+	for template, expected := range map[string]string{
+		"{{ .this.metadata.name }}":                     exp.Name,
+		"{{ .baseline.name }}/{{ .baseline.revision }}": "default/revision1",
+		"{{ .candidates.canary.revision }}":             "revision2",
+		"{{ .versions.default.revision }}":              "revision1",
+		"{{ .recommended.name }}":                       "default",
+		"{{ .revision }}":                               "revision1",
+		"{{ .winner.revision }}":                        "revision2",
+		"{{ .env.ITER8_MODEL_TEST }}":                   "env-value",
+		"{{ .secrets.creds.token }}":                    "t0ken",
+		"{{ .task.name }}":                              "",
+	} {
+		actual, err := tags.Interpolate(&template)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual, template)
+	}
+
+	// no version recommended for promotion and no winner
+	exp.Status.VersionRecommendedForPromotion = nil
+	exp.Status.Analysis = nil
+	template := "{{ .recommended.name }}{{ .winner.name }}{{ .revision }}"
+	tags = tasks.ExperimentTags(context.Background(), exp)
+	actual, err := tags.Interpolate(&template)
+	assert.NoError(t, err)
+	assert.Equal(t, "", actual)
+}
+
+func TestExperimentTagsTask(t *testing.T) {
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().Build(), nil
+	}
+
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+	ctx = context.WithValue(ctx, tasks.ContextKey("action"), "finish")
+
+	template := "{{ .task.action }} {{ .task.index }} {{ .task.name }} {{ .task.library }} {{ .task.task }}"
+	first := &templateTask{TaskMeta: tasks.TaskMeta{Task: "common/bash"}, template: template}
+	second := &templateTask{TaskMeta: tasks.TaskMeta{Library: "notification", Task: "slack"}, template: template}
+	action := tasks.Action{first, second}
+	assert.NoError(t, action.Run(ctx))
+	assert.Equal(t, "finish 0 common/bash common bash", first.result)
+	assert.Equal(t, "finish 1 notification/slack notification slack", second.result)
+}
+
+func TestConfigureStrictTemplates(t *testing.T) {
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().Build(), nil
+	}
+
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+
+	lenient := &templateTask{template: "{{ .missing }}"}
+	strict := &templateTask{template: "{{ .missing }}"}
+	assert.NoError(t, tasks.Configure(strict, &v2alpha2.TaskSpec{
+		Task: "common/bash",
+		With: map[string]apiextensionsv1.JSON{
+			"script":          {Raw: []byte(`"echo hello"`)},
+			"strictTemplates": {Raw: []byte(`true`)},
+		},
+	}))
+	assert.True(t, *strict.Common.StrictTemplates)
+
+	action := tasks.Action{lenient}
+	assert.NoError(t, action.Run(ctx))
+	action = tasks.Action{lenient, strict}
+	assert.Error(t, action.Run(ctx))
+}
+
+func TestSecretAndConfigMapRefs(t *testing.T) {
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"},
+			Data:       map[string][]byte{"user": []byte("admin"), "password": []byte("s3cr3t-passw0rd")},
+		}, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+			Data:       map[string]string{"endpoint": "https://example.com"},
+		}).Build(), nil
+	}
+
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+
+	task := &templateTask{template: "{{ .configMaps.settings.endpoint }} {{ .secrets.creds.password }} {{ .secrets.creds.user }}"}
+	assert.NoError(t, tasks.Configure(task, &v2alpha2.TaskSpec{
+		Task: "common/bash",
+		With: map[string]apiextensionsv1.JSON{
+			"secrets":    {Raw: []byte(`[{"name": "default/creds", "keys": ["password"]}]`)},
+			"configMaps": {Raw: []byte(`[{"name": "default/settings"}]`)},
+		},
+	}))
+	action := tasks.Action{task}
+	assert.NoError(t, action.Run(ctx))
+	assert.Equal(t, "https://example.com s3cr3t-passw0rd ", task.result)
+
+	// values of secrets are redacted from log output
+	log := tasks.GetLogger()
+	out := &bytes.Buffer{}
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+	log.WithField("password", "s3cr3t-passw0rd").Info("result: ", task.result)
+	assert.NotContains(t, out.String(), "s3cr3t-passw0rd")
+	assert.Contains(t, out.String(), "https://example.com "+tasks.Redacted)
+
+	// missing keys are errors
+	task.Common.Secrets[0].Keys = []string{"token"}
+	assert.Error(t, action.Run(ctx))
+
+	// objects with the same name in different namespaces are errors, since their data would have the same key
+	err = tasks.Configure(&templateTask{}, &v2alpha2.TaskSpec{
+		Task: "common/bash",
+		With: map[string]apiextensionsv1.JSON{
+			"secrets": {Raw: []byte(`[{"name": "default/creds"}, {"name": "other/creds"}]`)},
+		},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "default/creds and other/creds")
+	task.Common.Secrets = []tasks.ObjectRef{{Name: "creds"}, {Name: "other/creds"}}
+	assert.Error(t, action.Run(ctx))
+}
@@ -0,0 +1,114 @@
+package tasks
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces sensitive values in log output
+const Redacted = "[REDACTED]"
+
+// minSensitiveLength is the length of the shortest value that is redacted; shorter values would mask too much of the output
+const minSensitiveLength = 4
+
+// credentialPattern matches common credentials in log output, which are replaced by the expansion of replacement
+type credentialPattern struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// credentialPatterns match common credentials, which are redacted from log output even if they are not sourced from a secret
+var credentialPatterns = []credentialPattern{
+	// private keys
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), Redacted},
+	// credentials in authorization headers
+	{regexp.MustCompile(`(?i)(\b(?:bearer|basic)\s+)[A-Za-z0-9\-._~+/]{8,}=*`), "${1}" + Redacted},
+	// credentials in key value pairs, such as password: value, token=value and "apiKey": "value";
+	// secret is not one of the keys since it usually names a secret rather than holds its data
+	{regexp.MustCompile(`(?i)(\b(?:password|passwd|token|api[_-]?key|access[_-]?key|client[_-]?secret|private[_-]?key)["']?\s*[:=]\s*["']?)[^\s"'&,;)\]}]+`), "${1}" + Redacted},
+	// passwords in URLs
+	{regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`), "${1}" + Redacted + "@"},
+	// Slack, GitHub, GitLab and AWS tokens, and JSON web tokens
+	{regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`), Redacted},
+	{regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}`), Redacted},
+	{regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`), Redacted},
+	{regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), Redacted},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`), Redacted},
+	// Slack incoming webhooks
+	{regexp.MustCompile(`(hooks\.slack\.com/services/)[A-Za-z0-9/]+`), "${1}" + Redacted},
+}
+
+// sensitive holds the values that are redacted from log output, and a replacer that redacts them
+var sensitive = struct {
+	sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}{values: map[string]bool{}}
+
+// AddSensitiveValues adds values, such as the data of a secret, that are redacted from log output.
+func AddSensitiveValues(values ...string) {
+	sensitive.Lock()
+	defer sensitive.Unlock()
+	added := false
+	for _, v := range values {
+		if len(v) >= minSensitiveLength && !sensitive.values[v] {
+			sensitive.values[v] = true
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+	// replace longer values first, so that a value containing another is redacted as a whole
+	all := make([]string, 0, len(sensitive.values))
+	for v := range sensitive.values {
+		all = append(all, v)
+	}
+	sort.Slice(all, func(i, j int) bool { return len(all[i]) > len(all[j]) })
+	oldnew := make([]string, 0, 2*len(all))
+	for _, v := range all {
+		oldnew = append(oldnew, v, Redacted)
+	}
+	sensitive.replacer = strings.NewReplacer(oldnew...)
+}
+
+// Redact returns the given string with sensitive values and common credentials redacted.
+func Redact(s string) string {
+	sensitive.RLock()
+	if sensitive.replacer != nil {
+		s = sensitive.replacer.Replace(s)
+	}
+	sensitive.RUnlock()
+	for _, p := range credentialPatterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// redactHook redacts sensitive values from the message and fields of log entries
+type redactHook struct{}
+
+// Levels returns the levels of log entries that are redacted; all of them
+func (redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire redacts a log entry
+func (redactHook) Fire(e *logrus.Entry) error {
+	e.Message = Redact(e.Message)
+	for k, v := range e.Data {
+		if s, ok := v.(string); ok {
+			e.Data[k] = Redact(s)
+		} else if err, ok := v.(error); ok {
+			e.Data[k] = Redact(err.Error())
+		} else if s := fmt.Sprint(v); Redact(s) != s {
+			e.Data[k] = Redact(s)
+		}
+	}
+	return nil
+}
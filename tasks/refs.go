@@ -0,0 +1,128 @@
+package tasks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ObjectRef references a secret or config map, and optionally a subset of its keys.
+type ObjectRef struct {
+	// name of the object in the form namespace/name or name;
+	// if the namespace is omitted, the namespace of the experiment is used
+	Name string `json:"name" yaml:"name"`
+	// keys of the object that are available to templates; optional; default is all keys
+	Keys []string `json:"keys,omitempty" yaml:"keys,omitempty"`
+}
+
+// objectName returns the name of the referenced object, without its namespace
+func (r *ObjectRef) objectName() string {
+	return r.Name[strings.LastIndex(r.Name, "/")+1:]
+}
+
+// selectKeys returns the data of the referenced keys of an object
+func (r *ObjectRef) selectKeys(kind string, data map[string]string) (map[string]interface{}, error) {
+	selected := map[string]interface{}{}
+	if len(r.Keys) == 0 {
+		for k, v := range data {
+			selected[k] = v
+		}
+		return selected, nil
+	}
+	for _, k := range r.Keys {
+		v, ok := data[k]
+		if !ok {
+			return nil, fmt.Errorf("%s %s has no key %s", kind, r.Name, k)
+		}
+		selected[k] = v
+	}
+	return selected, nil
+}
+
+// uniqueObjectNames returns an error if two references are to objects with the same name, such as a/creds and b/creds,
+// since their data would be available to templates under the same key
+func uniqueObjectNames(kind string, refs []ObjectRef) error {
+	names := map[string]string{}
+	for i := range refs {
+		r := &refs[i]
+		if other, ok := names[r.objectName()]; ok {
+			return fmt.Errorf("%ss %s and %s have the same name %s", kind, other, r.Name, r.objectName())
+		}
+		names[r.objectName()] = r.Name
+	}
+	return nil
+}
+
+// validateRefs checks that the secrets, and the config maps, referenced by the inputs common to all tasks have unique names
+func (ci *CommonInputs) validateRefs() error {
+	if err := uniqueObjectNames("secret", ci.Secrets); err != nil {
+		return err
+	}
+	return uniqueObjectNames("config map", ci.ConfigMaps)
+}
+
+// loadRefs loads the secrets and config maps referenced by the inputs common to all tasks, by object name.
+// The data of the secrets is redacted from log output.
+func (ci *CommonInputs) loadRefs() (secrets map[string]interface{}, configMaps map[string]interface{}, err error) {
+	if err = ci.validateRefs(); err != nil {
+		return nil, nil, err
+	}
+	secrets = map[string]interface{}{}
+	for i := range ci.Secrets {
+		r := &ci.Secrets[i]
+		secret, err := GetSecret(r.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot get secret %s: %v", r.Name, err)
+		}
+		data := make(map[string]string, len(secret.Data))
+		for k, v := range secret.Data {
+			data[k] = string(v)
+		}
+		if secrets[r.objectName()], err = r.selectKeys("secret", data); err != nil {
+			return nil, nil, err
+		}
+		for _, v := range secrets[r.objectName()].(map[string]interface{}) {
+			AddSensitiveValues(v.(string))
+		}
+	}
+
+	configMaps = map[string]interface{}{}
+	for i := range ci.ConfigMaps {
+		r := &ci.ConfigMaps[i]
+		cm, err := GetConfigMap(r.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot get config map %s: %v", r.Name, err)
+		}
+		if configMaps[r.objectName()], err = r.selectKeys("config map", cm.Data); err != nil {
+			return nil, nil, err
+		}
+	}
+	return secrets, configMaps, nil
+}
+
+// RefKeys returns the keys under which the data of the secrets and config maps referenced by the inputs common to all tasks
+// is available to templates, such as .secrets.creds, or .secrets.creds.token if the reference lists the key token
+func (ci *CommonInputs) RefKeys() []string {
+	keys := []string{}
+	for _, refs := range []struct {
+		prefix string
+		refs   []ObjectRef
+	}{{".secrets.", ci.Secrets}, {".configMaps.", ci.ConfigMaps}} {
+		for i := range refs.refs {
+			r := &refs.refs[i]
+			if len(r.Keys) == 0 {
+				keys = append(keys, refs.prefix+r.objectName())
+			}
+			for _, k := range r.Keys {
+				keys = append(keys, refs.prefix+r.objectName()+"."+k)
+			}
+		}
+	}
+	return keys
+}
+
+// LoadRefs loads the secrets and config maps referenced by the inputs common to all tasks into the task info,
+// so that their data is available to templates as .secrets and .configMaps
+func (ti *TaskInfo) LoadRefs(ci *CommonInputs) (err error) {
+	ti.secrets, ti.configMaps, err = ci.loadRefs()
+	return err
+}
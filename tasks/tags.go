@@ -2,16 +2,100 @@ package tasks
 
 import (
 	"bytes"
-	"errors"
-	"html/template"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
 
 	"github.com/iter8-tools/etc3/api/v2alpha2"
 	corev1 "k8s.io/api/core/v1"
 )
 
+// TemplateMode is the mode in which Tags interpolate templates.
+type TemplateMode string
+
+const (
+	// TextTemplateMode interpolates templates using text/template; values are not escaped
+	TextTemplateMode TemplateMode = "text"
+
+	// HTMLTemplateMode interpolates templates using html/template, which HTML-escapes values.
+	// It is compatible with templates written when interpolation always used html/template.
+	HTMLTemplateMode TemplateMode = "html"
+)
+
+// emptyIfNoValueFunc is the name of the function that templates use to print missing values as empty strings
+const emptyIfNoValueFunc = "iter8EmptyIfNoValue"
+
+// emptyIfNoValue returns the empty string for missing and nil values, which text/template would print as <no value>;
+// other values are returned as is. html/template already prints missing values as empty strings.
+func emptyIfNoValue(v interface{}) interface{} {
+	if v == nil {
+		return ""
+	}
+	return v
+}
+
+// printEmptyIfNoValue appends emptyIfNoValue to the pipeline of every action of a template that prints a value
+func printEmptyIfNoValue(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			printEmptyIfNoValue(c)
+		}
+	case *parse.ActionNode:
+		// actions that declare or assign variables print nothing
+		if len(n.Pipe.Decl) == 0 {
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(emptyIfNoValueFunc).SetPos(n.Pos)},
+			})
+		}
+	case *parse.IfNode:
+		printEmptyIfNoValue(n.List)
+		printEmptyIfNoValue(n.ElseList)
+	case *parse.RangeNode:
+		printEmptyIfNoValue(n.List)
+		printEmptyIfNoValue(n.ElseList)
+	case *parse.WithNode:
+		printEmptyIfNoValue(n.List)
+		printEmptyIfNoValue(n.ElseList)
+	}
+}
+
+// templateMode is the default template mode
+var templateMode = TextTemplateMode
+
+// SetTemplateMode sets the default mode in which templates are interpolated.
+func SetTemplateMode(mode TemplateMode) error {
+	if mode != TextTemplateMode && mode != HTMLTemplateMode {
+		return fmt.Errorf("unknown template mode %s", mode)
+	}
+	templateMode = mode
+	return nil
+}
+
+// strictTemplates is true if templates are interpolated in strict mode by default
+var strictTemplates = false
+
+// SetStrictTemplates sets whether templates are interpolated in strict mode by default.
+// In strict mode, interpolation fails when a template references a missing key, instead of interpolating an empty string.
+func SetStrictTemplates(strict bool) {
+	strictTemplates = strict
+}
+
 // Tags supports string extrapolation using tags.
 type Tags struct {
 	M map[string]interface{}
+	// mode overrides the default template mode, if set
+	mode TemplateMode
+	// strict overrides the default strict mode, if set
+	strict *bool
 }
 
 // NewTags creates an empty instance of Tags
@@ -19,12 +103,13 @@ func NewTags() Tags {
 	return Tags{M: make(map[string]interface{})}
 }
 
-// WithSecret adds the fields in secret to tags
+// WithSecret adds the fields in secret to tags; their values are redacted from log output
 func (tags Tags) WithSecret(label string, secret *corev1.Secret) Tags {
 	if secret != nil {
 		obj := make(map[string]interface{})
 		for n, v := range secret.Data {
 			obj[n] = string(v)
+			AddSensitiveValues(string(v))
 		}
 		tags = tags.With(label, obj)
 	}
@@ -46,29 +131,33 @@ func (tags Tags) WithRecommendedVersionForPromotion(exp *v2alpha2.Experiment) Ta
 		return tags
 	}
 
-	versionRecommendedForPromotion := *exp.Status.VersionRecommendedForPromotion
-	if exp.Spec.VersionInfo == nil {
-		log.Warnf("No version details found for version recommended for promotion: %s", versionRecommendedForPromotion)
+	return tags.WithVersion(exp, *exp.Status.VersionRecommendedForPromotion)
+}
+
+// WithVersion adds variables from versionDetail of the named version
+func (tags Tags) WithVersion(exp *v2alpha2.Experiment, version string) Tags {
+	if exp == nil || exp.Spec.VersionInfo == nil {
+		log.Warnf("No version details found for version: %s", version)
 		return tags
 	}
 
 	var versionDetail *v2alpha2.VersionDetail = nil
-	if exp.Spec.VersionInfo.Baseline.Name == versionRecommendedForPromotion {
+	if exp.Spec.VersionInfo.Baseline.Name == version {
 		versionDetail = &exp.Spec.VersionInfo.Baseline
 	} else {
-		for _, v := range exp.Spec.VersionInfo.Candidates {
-			if v.Name == versionRecommendedForPromotion {
-				versionDetail = &v
+		for i := range exp.Spec.VersionInfo.Candidates {
+			if exp.Spec.VersionInfo.Candidates[i].Name == version {
+				versionDetail = &exp.Spec.VersionInfo.Candidates[i]
 				break
 			}
 		}
 	}
 	if versionDetail == nil {
-		log.Warnf("No version details found for version recommended for promotion: %s", versionRecommendedForPromotion)
+		log.Warnf("No version details found for version: %s", version)
 		return tags
 	}
 
-	// get the variable values from the (recommended) versionDetail
+	// get the variable values from the versionDetail
 	tags.M["name"] = versionDetail.Name
 	for _, v := range versionDetail.Variables {
 		tags.M[v.Name] = v.Value
@@ -77,21 +166,156 @@ func (tags Tags) WithRecommendedVersionForPromotion(exp *v2alpha2.Experiment) Ta
 	return tags
 }
 
+// WithTemplateMode sets the mode in which tags interpolate templates, overriding the default.
+// For example, templates of HTML documents are interpolated in HTMLTemplateMode so that values are escaped.
+func (tags Tags) WithTemplateMode(mode TemplateMode) Tags {
+	tags.mode = mode
+	return tags
+}
+
+// WithStrict sets whether tags interpolate templates in strict mode, overriding the default.
+func (tags Tags) WithStrict(strict bool) Tags {
+	tags.strict = &strict
+	return tags
+}
+
+// IsStrict returns true if tags interpolate templates in strict mode.
+func (tags *Tags) IsStrict() bool {
+	if tags.strict != nil {
+		return *tags.strict
+	}
+	return strictTemplates
+}
+
+// Has returns true if tags have a value for the key, such as .this.metadata.name
+func (tags *Tags) Has(key string) bool {
+	if tags == nil {
+		return false
+	}
+	var v interface{} = tags.M
+	for _, k := range strings.Split(strings.TrimPrefix(key, "."), ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if v, ok = m[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // Interpolate str using tags.
+// Templates may use the functions in FuncMap. Missing values are interpolated as empty strings,
+// unless templates are interpolated in strict mode, in which case missing keys are errors.
 func (tags *Tags) Interpolate(str *string) (string, error) {
 	if tags == nil || tags.M == nil { // return a copy of the string
 		return *str, nil
 	}
+	mode := templateMode
+	if tags.mode != "" {
+		mode = tags.mode
+	}
+	missingKey := "missingkey=default"
+	if tags.IsStrict() {
+		missingKey = "missingkey=error"
+	}
+
 	var err error
-	var templ *template.Template
-	if templ, err = template.New("").Parse(*str); err == nil {
-		buf := bytes.Buffer{}
-		if err = templ.Execute(&buf, tags.M); err == nil {
-			return string(buf.Bytes()), nil
+	buf := bytes.Buffer{}
+	if mode == HTMLTemplateMode {
+		var templ *htmltemplate.Template
+		if templ, err = htmltemplate.New("").Option(missingKey).Funcs(FuncMap()).Parse(*str); err != nil {
+			log.Error("template creation error: ", err)
+			return "", fmt.Errorf("cannot interpolate string: %v", err)
+		}
+		err = templ.Execute(&buf, tags.M)
+	} else {
+		var templ *template.Template
+		funcs := FuncMap()
+		funcs[emptyIfNoValueFunc] = emptyIfNoValue
+		if templ, err = template.New("").Option(missingKey).Funcs(funcs).Parse(*str); err != nil {
+			log.Error("template creation error: ", err)
+			return "", fmt.Errorf("cannot interpolate string: %v", err)
+		}
+		// missing values are printed as empty strings while the template is executed, rather than replacing
+		// <no value> in the output, which could also be part of the values themselves
+		for _, t := range templ.Templates() {
+			if t.Tree != nil {
+				printEmptyIfNoValue(t.Tree.Root)
+			}
 		}
+		err = templ.Execute(&buf, tags.M)
+	}
+	if err != nil {
 		log.Error("template execution error: ", err)
-		return "", errors.New("cannot interpolate string")
+		return "", fmt.Errorf("cannot interpolate string: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// TemplateKeys returns the keys referenced by a template, such as .this.metadata.name, sorted and without duplicates.
+// Keys referenced inside range and with blocks are relative to the value of dot in the block.
+func TemplateKeys(str string) ([]string, error) {
+	templ, err := template.New("").Funcs(FuncMap()).Parse(str)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse template: %v", err)
+	}
+	found := map[string]bool{}
+	if templ.Tree != nil {
+		templateKeys(templ.Tree.Root, found)
+	}
+	keys := make([]string, 0, len(found))
+	for k := range found {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// templateKeys adds the keys referenced by a node of a template to found
+func templateKeys(node parse.Node, found map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			templateKeys(c, found)
+		}
+	case *parse.ActionNode:
+		templateKeys(n.Pipe, found)
+	case *parse.IfNode:
+		templateKeys(&n.BranchNode, found)
+	case *parse.RangeNode:
+		templateKeys(&n.BranchNode, found)
+	case *parse.WithNode:
+		templateKeys(&n.BranchNode, found)
+	case *parse.BranchNode:
+		templateKeys(n.Pipe, found)
+		templateKeys(n.List, found)
+		templateKeys(n.ElseList, found)
+	case *parse.TemplateNode:
+		templateKeys(n.Pipe, found)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			templateKeys(c, found)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			templateKeys(a, found)
+		}
+	case *parse.ChainNode:
+		templateKeys(n.Node, found)
+	case *parse.FieldNode:
+		found["."+strings.Join(n.Ident, ".")] = true
+	case *parse.VariableNode:
+		// $ is the data passed to the template, so $.a.b references the key .a.b
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			found["."+strings.Join(n.Ident[1:], ".")] = true
+		}
 	}
-	log.Error("template creation error: ", err)
-	return "", errors.New("cannot interpolate string")
 }
@@ -92,3 +92,142 @@ func TestWithOutVersionRecommendedForPromotion(t *testing.T) {
 	assert.NotContains(t, tags.M, "revision1")
 	// assert.Equal(t, "revision1", tags.M["revision"])
 }
+
+func TestWithVersion(t *testing.T) {
+	var data []byte
+	data, err := ioutil.ReadFile(filepath.Join("..", "testdata", "experiment1.yaml"))
+	assert.NoError(t, err)
+	exp := &v2alpha2.Experiment{}
+	err = yaml.Unmarshal(data, exp)
+	assert.NoError(t, err)
+
+	tags := tasks.NewTags().WithVersion(exp, "canary")
+	assert.Equal(t, "canary", tags.M["name"])
+	assert.Equal(t, "revision2", tags.M["revision"])
+
+	tags = tasks.NewTags().WithVersion(exp, "unknown")
+	assert.NotContains(t, tags.M, "revision")
+}
+
+func TestInterpolateTemplateModes(t *testing.T) {
+	tags := tasks.NewTags().
+		With("url", "http://svc?a=1&b=2").
+		With("html", "<b>bold</b>")
+
+	// values are not escaped by default
+	str := `{"url": "{{ .url }}", "html": "{{ .html }}"}`
+	interpolated, err := tags.Interpolate(&str)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"url": "http://svc?a=1&b=2", "html": "<b>bold</b>"}`, interpolated)
+
+	// values are escaped in html mode
+	str = "<p>{{ .html }}</p>"
+	htmlTags := tags.WithTemplateMode(tasks.HTMLTemplateMode)
+	interpolated, err = htmlTags.Interpolate(&str)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>&lt;b&gt;bold&lt;/b&gt;</p>", interpolated)
+
+	assert.Error(t, tasks.SetTemplateMode("xml"))
+	assert.NoError(t, tasks.SetTemplateMode(tasks.HTMLTemplateMode))
+	interpolated, err = tags.Interpolate(&str)
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>&lt;b&gt;bold&lt;/b&gt;</p>", interpolated)
+	assert.NoError(t, tasks.SetTemplateMode(tasks.TextTemplateMode))
+}
+
+func TestInterpolateFunctions(t *testing.T) {
+	tags := tasks.NewTags().
+		With("name", "Tester").
+		With("quote", "it's").
+		With("versions", []interface{}{"v1", "v2"}).
+		With("obj", map[string]interface{}{"a": 1, "b": []interface{}{"x"}})
+
+	for template, expected := range map[string]string{
+		`{{ .name | lower }}-{{ .name | upper }}`:                        "tester-TESTER",
+		`{{ .name | trimPrefix "Te" | replace "s" "x" }}`:                "xter",
+		`{{ .missing | default "none" }}`:                                "none",
+		`{{ .name | default "none" }}`:                                   "Tester",
+		`{{ trunc 3 .name }} {{ trunc 2 "héllo" }} {{ trunc 9 "日本語" }}`:  "Tes hé 日本語",
+		`{{ join "," .versions }} {{ first .versions }}`:                 "v1,v2 v1",
+		`{{ has "v2" .versions }} {{ has "v3" .versions }}`:              "true false",
+		`{{ $d := dict "k" "v" }}{{ get $d "k" }}{{ keys .obj }}`:        "v[a b]",
+		`{{ .obj | toJson }}`:                                            `{"a":1,"b":["x"]}`,
+		`{{ .obj | toYaml }}`:                                            "a: 1\nb:\n- x",
+		`{{ .name | b64enc }} {{ "VGVzdGVy" | b64dec }}`:                 "VGVzdGVy Tester",
+		`{{ .quote | quote }}`:                                           `"it's"`,
+		`echo {{ .quote | shellQuote }}`:                                 `echo 'it'\''s'`,
+		`{{ regexMatch "^T.*r$" .name }}`:                                "true",
+		`{{ regexReplaceAll "e(s)" .name "${1}${1}" }}`:                  "Tsster",
+		`{{ regexFind "[a-z]+" .name }} {{ regexFindAll "e" .name -1 }}`: "ester [e e]",
+	} {
+		interpolated, err := tags.Interpolate(&template)
+		assert.NoError(t, err, template)
+		assert.Equal(t, expected, interpolated, template)
+	}
+
+	str := `{{ required "repository is required" .repository }}`
+	_, err := tags.Interpolate(&str)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "repository is required")
+}
+
+func TestInterpolateStrict(t *testing.T) {
+	tags := tasks.NewTags().
+		With("name", "tester").
+		With("recommended", map[string]interface{}{"revision": "revision1"})
+
+	// missing keys are interpolated as empty strings by default
+	str := "{{ .name }} {{ .revision }} {{ .winner.revision }}"
+	interpolated, err := tags.Interpolate(&str)
+	assert.NoError(t, err)
+	assert.Equal(t, "tester  ", interpolated)
+	assert.False(t, tags.IsStrict())
+
+	// values that contain <no value> are interpolated as is, including in nested templates and blocks
+	literal := tags.With("literal", "<no value>")
+	nested := `{{ define "t" }}{{ .missing }}{{ end }}{{ .literal }}|{{ template "t" . }}|{{ if .name }}{{ .missing }}{{ end }}|{{ $x := .missing }}{{ $x }}`
+	interpolated, err = literal.Interpolate(&nested)
+	assert.NoError(t, err)
+	assert.Equal(t, "<no value>|||", interpolated)
+
+	// missing keys are errors in strict mode
+	strictTags := tags.WithStrict(true)
+	_, err = strictTags.Interpolate(&str)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `"revision"`)
+	str = "{{ .name }} {{ .recommended.revision }}"
+	interpolated, err = strictTags.Interpolate(&str)
+	assert.NoError(t, err)
+	assert.Equal(t, "tester revision1", interpolated)
+
+	// the default may be strict, and overridden by tags
+	tasks.SetStrictTemplates(true)
+	defer tasks.SetStrictTemplates(false)
+	str = "{{ .winner.revision }}"
+	_, err = tags.Interpolate(&str)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `"winner"`)
+	lenientTags := tags.WithStrict(false)
+	interpolated, err = lenientTags.Interpolate(&str)
+	assert.NoError(t, err)
+	assert.Equal(t, "", interpolated)
+}
+
+func TestTemplateKeys(t *testing.T) {
+	keys, err := tasks.TemplateKeys(`{{ .this.metadata.name }} {{ if .winner }}{{ .winner.name | quote }}{{ else }}{{ $.recommended.name }}{{ end }} {{ .this.metadata.name }}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".recommended.name", ".this.metadata.name", ".winner", ".winner.name"}, keys)
+
+	keys, err = tasks.TemplateKeys("no templates")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	_, err = tasks.TemplateKeys("{{ .name ")
+	assert.Error(t, err)
+
+	tags := tasks.NewTags().With("this", map[string]interface{}{"metadata": map[string]interface{}{"name": "exp"}})
+	assert.True(t, tags.Has(".this.metadata.name"))
+	assert.True(t, tags.Has(".this"))
+	assert.False(t, tags.Has(".this.metadata.namespace"))
+	assert.False(t, tags.Has(".this.metadata.name.first"))
+}
@@ -0,0 +1,60 @@
+package tasks
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TLSData returns the CA bundle in the CA secret under the key ca.crt, and the client certificate and key
+// in the cert secret under the keys tls.crt and tls.key, keyed as in the secrets. Either secret may be nil.
+func TLSData(caSecret *string, certSecret *string) (map[string][]byte, error) {
+	data := make(map[string][]byte)
+	refs := []struct {
+		secret *string
+		keys   []string
+	}{
+		{caSecret, []string{corev1.ServiceAccountRootCAKey}},
+		{certSecret, []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey}},
+	}
+	for _, ref := range refs {
+		if ref.secret == nil {
+			continue
+		}
+		secret, err := GetSecret(*ref.secret)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range ref.keys {
+			content, ok := secret.Data[key]
+			if !ok {
+				return nil, fmt.Errorf("key %s not found in secret %s", key, *ref.secret)
+			}
+			data[key] = content
+		}
+	}
+	return data, nil
+}
+
+// TLSConfig constructs a TLS configuration from the CA bundle, and client certificate and key, in data returned by TLSData
+func TLSConfig(data map[string][]byte, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if ca, ok := data[corev1.ServiceAccountRootCAKey]; ok {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found under key %s", corev1.ServiceAccountRootCAKey)
+		}
+	}
+	if cert, ok := data[corev1.TLSCertKey]; ok {
+		pair, err := tls.X509KeyPair(cert, data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate under key %s: %s", corev1.TLSCertKey, err.Error())
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	return config, nil
+}
@@ -0,0 +1,63 @@
+package tasks_test
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "default"},
+		Data:       map[string][]byte{corev1.ServiceAccountRootCAKey: ca},
+	}, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cert", Namespace: "default"},
+		Data:       map[string][]byte{corev1.TLSCertKey: []byte("not a certificate")},
+	}).Build()
+	tasks.GetClient = func() (client.Client, error) {
+		return c, nil
+	}
+
+	data, err := tasks.TLSData(tasks.StringPointer("default/ca"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ca, data[corev1.ServiceAccountRootCAKey])
+	config, err := tasks.TLSConfig(data, false)
+	assert.NoError(t, err)
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	resp, err := httpClient.Get(srv.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// both the certificate and key are required
+	_, err = tasks.TLSData(nil, tasks.StringPointer("default/cert"))
+	assert.Error(t, err)
+	_, err = tasks.TLSData(tasks.StringPointer("default/missing"), nil)
+	assert.Error(t, err)
+
+	_, err = tasks.TLSConfig(map[string][]byte{corev1.ServiceAccountRootCAKey: []byte("not a bundle")}, false)
+	assert.Error(t, err)
+	_, err = tasks.TLSConfig(map[string][]byte{corev1.TLSCertKey: []byte("a"), corev1.TLSPrivateKeyKey: []byte("b")}, false)
+	assert.Error(t, err)
+	config, err = tasks.TLSConfig(map[string][]byte{}, true)
+	assert.NoError(t, err)
+	assert.True(t, config.InsecureSkipVerify)
+}
+
+func TestJSONPathTemplate(t *testing.T) {
+	assert.Equal(t, "{.data.result[0]}", tasks.JSONPathTemplate(".data.result[0]"))
+	assert.Equal(t, "{.items[*].name}", tasks.JSONPathTemplate("{.items[*].name}"))
+}
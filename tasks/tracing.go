@@ -0,0 +1,199 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer of the handler
+const TracerName = "github.com/iter8-tools/handler"
+
+// ServiceName is the default name of the handler in traces; it is overridden by OTEL_SERVICE_NAME
+const ServiceName = "iter8-handler"
+
+// Attributes of spans that identify the experiment, action, task and version to which a span relates
+const (
+	ExperimentAttribute = attribute.Key("iter8.experiment")
+	NamespaceAttribute  = attribute.Key("iter8.namespace")
+	ActionAttribute     = attribute.Key("iter8.action")
+	TaskIndexAttribute  = attribute.Key("iter8.task.index")
+	TaskAttribute       = attribute.Key("iter8.task")
+	VersionAttribute    = attribute.Key("iter8.version")
+)
+
+// tracingEnabled returns true if an exporter of traces is configured by the standard OpenTelemetry environment variables
+func tracingEnabled() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return false
+	}
+	if exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter != "" {
+		return exporter != "none"
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// newExporter returns the exporter of traces named by OTEL_TRACES_EXPORTER; the default is otlp
+func newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	switch exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter {
+	case "", "otlp":
+		// the endpoint, headers, certificate, compression and timeout are read from OTEL_EXPORTER_OTLP_* variables
+		return otlptracehttp.New(ctx)
+	case "console", "stdout":
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stderr), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unsupported traces exporter %s; supported exporters are otlp, console and none", exporter)
+	}
+}
+
+// SetupTracing configures tracing using the standard OpenTelemetry environment variables.
+// Traces are exported if OTEL_TRACES_EXPORTER is otlp or console, or if an OTLP endpoint is set;
+// otherwise spans are not recorded.
+// The returned function flushes and stops the export of spans.
+func SetupTracing(ctx context.Context) (func(context.Context) error, error) {
+	shutdown := func(context.Context) error { return nil }
+	if !tracingEnabled() {
+		return shutdown, nil
+	}
+	exporter, err := newExporter(ctx)
+	if err != nil {
+		return shutdown, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the default service name
+	res, err := resource.Merge(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName)), resource.Environment())
+	if err != nil {
+		log.Warn("cannot read resource of traces from environment: ", err)
+		res = resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName))
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	log.Trace("tracing enabled")
+	return tp.Shutdown, nil
+}
+
+// traceParent is the context of the running task, which is the parent of spans started without a span in their context,
+// such as those of HTTP requests and Kubernetes API calls made without a context
+var traceParent = struct {
+	sync.RWMutex
+	ctx context.Context
+}{}
+
+// setTraceParent sets the context of the running task
+func setTraceParent(ctx context.Context) {
+	traceParent.Lock()
+	defer traceParent.Unlock()
+	traceParent.ctx = ctx
+}
+
+// parentContext returns ctx if it holds a span, and the context of the running task otherwise
+func parentContext(ctx context.Context) context.Context {
+	if ctx != nil && trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	traceParent.RLock()
+	defer traceParent.RUnlock()
+	if traceParent.ctx != nil {
+		if ctx == nil {
+			return traceParent.ctx
+		}
+		return trace.ContextWithSpan(ctx, trace.SpanFromContext(traceParent.ctx))
+	}
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// experimentAttributes returns the attributes identifying the experiment in the context, if any
+func experimentAttributes(ctx context.Context) []attribute.KeyValue {
+	if exp, err := GetExperimentFromContext(ctx); err == nil && exp != nil {
+		return []attribute.KeyValue{ExperimentAttribute.String(exp.Name), NamespaceAttribute.String(exp.Namespace)}
+	}
+	return nil
+}
+
+// StartSpan starts a span that is a child of the span in ctx, or of the span of the running task if ctx has none.
+// The span has the attributes identifying the experiment in ctx in addition to attrs.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx = parentContext(ctx)
+	attrs = append(experimentAttributes(ctx), attrs...)
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan ends a span, recording err if it is not nil.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(errors.New(Redact(err.Error())))
+		span.SetStatus(codes.Error, Redact(err.Error()))
+	}
+	span.End()
+}
+
+// tracedTransport starts a span for each HTTP request
+type tracedTransport struct {
+	base http.RoundTripper
+}
+
+// TracedTransport returns a transport that starts a span for each HTTP request it makes through rt,
+// and propagates the trace to the server. If rt is nil, http.DefaultTransport is used.
+func TracedTransport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &tracedTransport{base: rt}
+}
+
+// RoundTrip makes an HTTP request within a span
+func (t *tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := otel.Tracer(TracerName).Start(parentContext(req.Context()), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.HTTPURLKey.String(Redact(req.URL.Redacted())),
+			semconv.NetPeerNameKey.String(req.URL.Hostname()),
+		))
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(resp.StatusCode))
+	}
+	EndSpan(span, err)
+	return resp, err
+}
+
+// RunCommand runs a command within a span that is a child of the span in ctx.
+func RunCommand(ctx context.Context, cmd *exec.Cmd) error {
+	_, span := StartSpan(ctx, "exec "+filepath.Base(cmd.Path),
+		attribute.String("process.command", cmd.Path),
+		attribute.String("process.command_line", Redact(cmd.String())),
+	)
+	err := cmd.Run()
+	if cmd.ProcessState != nil {
+		span.SetAttributes(attribute.Int("process.exit_code", cmd.ProcessState.ExitCode()))
+	}
+	EndSpan(span, err)
+	return err
+}
@@ -0,0 +1,83 @@
+package tasks_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// tracedTask makes an HTTP request without a context, and runs a subprocess
+type tracedTask struct {
+	tasks.TaskMeta
+	url string
+}
+
+func (t *tracedTask) Run(ctx context.Context) error {
+	httpClient := &http.Client{Transport: tasks.TracedTransport(nil)}
+	resp, err := httpClient.Get(t.url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return tasks.RunCommand(ctx, exec.Command("true"))
+}
+
+func TestTracing(t *testing.T) {
+	getClient := tasks.GetClient
+	defer func() { tasks.GetClient = getClient }()
+	tasks.GetClient = func() (client.Client, error) {
+		return fake.NewClientBuilder().Build(), nil
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	traceparent := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tasks.ContextKey("experiment"), exp)
+	ctx = context.WithValue(ctx, tasks.ContextKey("action"), "start")
+	action := tasks.Action{&tracedTask{TaskMeta: tasks.TaskMeta{Task: "common/exec"}, url: server.URL + "?token=t0k3n"}}
+	assert.NoError(t, action.Run(ctx))
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	assert.Len(t, spans, 4)
+	actionSpan, taskSpan := spans["action start"], spans["task common/exec"]
+	if assert.NotNil(t, actionSpan) && assert.NotNil(t, taskSpan) {
+		assert.Contains(t, actionSpan.Attributes(), tasks.ExperimentAttribute.String(exp.Name))
+		assert.Equal(t, actionSpan.SpanContext().SpanID(), taskSpan.Parent().SpanID())
+		assert.Contains(t, taskSpan.Attributes(), tasks.TaskIndexAttribute.Int(0))
+		for _, name := range []string{"HTTP GET", "exec true"} {
+			if assert.NotNil(t, spans[name], name) {
+				assert.Equal(t, taskSpan.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+			}
+		}
+	}
+	if s := spans["HTTP GET"]; s != nil {
+		assert.Contains(t, s.Attributes(), attribute.String("http.url", server.URL+"?token=[REDACTED]"))
+		assert.Contains(t, traceparent, s.SpanContext().SpanID().String())
+	}
+}
@@ -0,0 +1,160 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+// resettableRESTMapper is a RESTMapper whose discovery information can be discarded, so that kinds installed since it was discovered are found
+type resettableRESTMapper interface {
+	meta.RESTMapper
+	Reset()
+}
+
+// cachedDynamicClient is the client returned by GetDynamicClient; it is created when first used
+var cachedDynamicClient = struct {
+	sync.Mutex
+	c      dynamic.Interface
+	mapper meta.RESTMapper
+}{}
+
+// GetDynamicClient returns a dynamic K8s client, which can access objects of any kind as unstructured objects,
+// and a RESTMapper, which maps kinds to resources using the discovery information of the cluster.
+// They are created when first used and reused afterwards.
+var GetDynamicClient = func() (dynamic.Interface, meta.RESTMapper, error) {
+	cachedDynamicClient.Lock()
+	defer cachedDynamicClient.Unlock()
+	if cachedDynamicClient.c == nil {
+		restConf, err := restConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+		dc, err := dynamic.NewForConfig(restConf)
+		if err != nil {
+			return nil, nil, err
+		}
+		disc, err := discovery.NewDiscoveryClientForConfig(restConf)
+		if err != nil {
+			return nil, nil, err
+		}
+		cachedDynamicClient.c = dc
+		cachedDynamicClient.mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disc))
+	}
+	return cachedDynamicClient.c, cachedDynamicClient.mapper, nil
+}
+
+// resetDynamicClient discards the client returned by GetDynamicClient, so that it is created again when next used
+func resetDynamicClient() {
+	cachedDynamicClient.Lock()
+	defer cachedDynamicClient.Unlock()
+	cachedDynamicClient.c = nil
+	cachedDynamicClient.mapper = nil
+}
+
+// resourceInterface returns the interface to the resource of the given kind in the given namespace.
+// The namespace is ignored if the kind is not namespaced.
+func resourceInterface(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+	dc, mapper, err := GetDynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// the kind may have been installed since the discovery information was cached
+		if m, ok := mapper.(resettableRESTMapper); ok {
+			m.Reset()
+			mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot find resource of kind %s: %v", gvk, err)
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return dc.Resource(mapping.Resource).Namespace(namespace), nil
+	}
+	return dc.Resource(mapping.Resource), nil
+}
+
+// GetUnstructuredObject gets an object of any kind from the k8s cluster.
+// Transient errors are retried, as in GetTypedObjectWithContext.
+func GetUnstructuredObject(ctx context.Context, gvk schema.GroupVersionKind, nn types.NamespacedName) (*unstructured.Unstructured, error) {
+	ri, err := resourceInterface(gvk, nn.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	var obj *unstructured.Unstructured
+	err = retryTransient(ctx, fmt.Sprintf("get %s %s", gvk.Kind, nn), func() (err error) {
+		obj, err = ri.Get(ctx, nn.Name, metav1.GetOptions{})
+		return err
+	})
+	return obj, err
+}
+
+// ListUnstructuredObjects lists objects of any kind in a namespace of the k8s cluster, or in all namespaces if namespace is empty.
+// Transient errors are retried, as in GetTypedObjectWithContext.
+func ListUnstructuredObjects(ctx context.Context, gvk schema.GroupVersionKind, namespace string, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	ri, err := resourceInterface(gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var list *unstructured.UnstructuredList
+	err = retryTransient(ctx, fmt.Sprintf("list %s in namespace %s", gvk.Kind, namespace), func() (err error) {
+		list, err = ri.List(ctx, opts)
+		return err
+	})
+	return list, err
+}
+
+// PatchUnstructuredObject patches an object of any kind in the k8s cluster, and returns the patched object.
+// The patch is of the given type, such as types.MergePatchType or types.JSONPatchType.
+// Unlike gets and lists, patches are not retried: a patch that timed out may have been applied,
+// and applying some patches, such as JSON patches that add to a list, again would change the object again.
+func PatchUnstructuredObject(ctx context.Context, gvk schema.GroupVersionKind, nn types.NamespacedName, pt types.PatchType, patch []byte) (*unstructured.Unstructured, error) {
+	ri, err := resourceInterface(gvk, nn.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return ri.Patch(ctx, nn.Name, pt, patch, metav1.PatchOptions{})
+}
+
+// ObjectRefKey returns the kind and the namespaced name of the object referenced in an experiment, such as the weightObjRef of a version.
+// If the reference has no namespace, the namespace of the experiment is used.
+func (e *Experiment) ObjectRefKey(ref *corev1.ObjectReference) (schema.GroupVersionKind, types.NamespacedName, error) {
+	if ref == nil {
+		return schema.GroupVersionKind{}, types.NamespacedName{}, errors.New("nil object reference")
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return schema.GroupVersionKind{}, types.NamespacedName{}, err
+	}
+	if ref.Kind == "" || ref.Name == "" {
+		return schema.GroupVersionKind{}, types.NamespacedName{}, fmt.Errorf("object reference %s/%s has no kind or name", ref.Kind, ref.Name)
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = e.Namespace
+	}
+	return gv.WithKind(ref.Kind), types.NamespacedName{Namespace: namespace, Name: ref.Name}, nil
+}
+
+// GetReferencedObject gets the object referenced in an experiment, such as the weightObjRef of a version, from the k8s cluster.
+func (e *Experiment) GetReferencedObject(ctx context.Context, ref *corev1.ObjectReference) (*unstructured.Unstructured, error) {
+	gvk, nn, err := e.ObjectRefKey(ref)
+	if err != nil {
+		return nil, err
+	}
+	return GetUnstructuredObject(ctx, gvk, nn)
+}
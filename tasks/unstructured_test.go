@@ -0,0 +1,89 @@
+package tasks_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iter8-tools/handler/tasks"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestUnstructuredObjects(t *testing.T) {
+	exp, err := (&tasks.Builder{}).FromFile(tasks.CompletePath("../", "testdata/experiment1.yaml")).Build()
+	assert.NoError(t, err)
+	ref := exp.Spec.VersionInfo.Candidates[0].WeightObjRef
+
+	isvc := schema.GroupVersionKind{Group: "serving.kubeflow.org", Version: "v1alpha2", Kind: "InferenceService"}
+	vs := schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1beta1", Kind: "VirtualService"}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(isvc, meta.RESTScopeNamespace)
+	mapper.Add(vs, meta.RESTScopeNamespace)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(isvc)
+	obj.SetNamespace("default")
+	obj.SetName("sklearn-iris")
+	assert.NoError(t, unstructured.SetNestedField(obj.Object, int64(0), "spec", "canaryTrafficPercent"))
+	dc := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		isvc.GroupVersion().WithResource("inferenceservices"): "InferenceServiceList",
+		vs.GroupVersion().WithResource("virtualservices"):     "VirtualServiceList",
+	}, obj)
+
+	getDynamicClient := tasks.GetDynamicClient
+	defer func() { tasks.GetDynamicClient = getDynamicClient }()
+	tasks.GetDynamicClient = func() (dynamic.Interface, meta.RESTMapper, error) {
+		return dc, mapper, nil
+	}
+
+	// get the object referenced by the experiment
+	got, err := exp.GetReferencedObject(context.Background(), ref)
+	assert.NoError(t, err)
+	assert.Equal(t, "sklearn-iris", got.GetName())
+
+	// list objects of a kind
+	list, err := tasks.ListUnstructuredObjects(context.Background(), isvc, "default", metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, list.Items, 1)
+	list, err = tasks.ListUnstructuredObjects(context.Background(), vs, "default", metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, list.Items)
+
+	// patch the object referenced by the experiment
+	gvk, nn, err := exp.ObjectRefKey(ref)
+	assert.NoError(t, err)
+	assert.Equal(t, isvc, gvk)
+	assert.Equal(t, types.NamespacedName{Namespace: "default", Name: "sklearn-iris"}, nn)
+	patched, err := tasks.PatchUnstructuredObject(context.Background(), gvk, nn, types.MergePatchType, []byte(`{"spec":{"canaryTrafficPercent":20}}`))
+	assert.NoError(t, err)
+	percent, _, err := unstructured.NestedInt64(patched.Object, "spec", "canaryTrafficPercent")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), percent)
+
+	// patches are not retried, since they may have been applied
+	patches := 0
+	dc.PrependReactor("patch", "inferenceservices", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patches++
+		return true, nil, apierrors.NewServiceUnavailable("unavailable")
+	})
+	_, err = tasks.PatchUnstructuredObject(context.Background(), gvk, nn, types.JSONPatchType, []byte(`[{"op":"add","path":"/spec/labels/-","value":"x"}]`))
+	assert.Error(t, err)
+	assert.Equal(t, 1, patches)
+
+	// objects that are not found, and kinds that are not known, are errors
+	_, err = tasks.GetUnstructuredObject(context.Background(), isvc, types.NamespacedName{Namespace: "default", Name: "missing"})
+	assert.Error(t, err)
+	_, err = tasks.GetUnstructuredObject(context.Background(), schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Unknown"}, nn)
+	assert.Error(t, err)
+	_, err = exp.GetReferencedObject(context.Background(), nil)
+	assert.Error(t, err)
+}
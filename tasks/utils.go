@@ -4,11 +4,13 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	iter8utils "github.com/iter8-tools/etc3/util"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 var log *logrus.Logger
@@ -24,13 +26,14 @@ func SetLogLevel(l logrus.Level) {
 }
 
 // GetLogger returns a logger, if needed after creating it.
+// The fields added by AddLogFields are added to its entries, and sensitive values (see AddSensitiveValues) are redacted from its output.
 func GetLogger() *logrus.Logger {
 	if log == nil {
 		log = logrus.New()
 		log.SetLevel(logLevel)
-		log.SetFormatter(&logrus.TextFormatter{
-			DisableQuote: true,
-		})
+		log.SetFormatter(formatter(logFormat))
+		log.AddHook(fieldsHook{})
+		log.AddHook(redactHook{})
 	}
 	return log
 }
@@ -66,6 +69,12 @@ func BoolPointer(b bool) *bool {
 	return &b
 }
 
+// QuantityPointer takes a quantity as input, creates a deep copy of the input, and returns a pointer to the copy
+func QuantityPointer(q resource.Quantity) *resource.Quantity {
+	c := q.DeepCopy()
+	return &c
+}
+
 // HTTPMethod is either GET or POST
 type HTTPMethod string
 
@@ -104,7 +113,7 @@ func WaitTimeoutOrError(wg *sync.WaitGroup, timeout time.Duration, errCh chan er
 
 // GetJSONBytes downloads JSON from URL and returns a byte slice
 func GetJSONBytes(url string) ([]byte, error) {
-	var myClient = &http.Client{Timeout: 10 * time.Second}
+	var myClient = &http.Client{Timeout: 10 * time.Second, Transport: TracedTransport(nil)}
 	r, err := myClient.Get(url)
 	if err != nil || r.StatusCode >= 400 {
 		return nil, errors.New("Error while fetching payload")
@@ -113,3 +122,12 @@ func GetJSONBytes(url string) ([]byte, error) {
 	body, err := ioutil.ReadAll(r.Body)
 	return body, err
 }
+
+// JSONPathTemplate wraps a JSON path, such as .data.result[0], in braces as expected by k8s.io/client-go/util/jsonpath,
+// unless it is already a template
+func JSONPathTemplate(path string) string {
+	if strings.HasPrefix(path, "{") {
+		return path
+	}
+	return "{" + path + "}"
+}